@@ -12,10 +12,12 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	api "github.com/shigawire-dev/internal/api"
+	"github.com/shigawire-dev/internal/certs"
 	control "github.com/shigawire-dev/internal/control"
 	"github.com/shigawire-dev/internal/proxy"
 	"github.com/shigawire-dev/internal/replay"
 	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/vault"
 )
 
 func main() {
@@ -46,25 +48,56 @@ func main() {
 		}
 	}()
 
-	rec, err := control.NewRecordingState(store.DB)
+	// Events recorded by earlier versions keep their bodies inline until they
+	// are moved to the bodies table.
+	go func() {
+		moved, err := store.MoveInlineBodies()
+		if err != nil {
+			log.Printf("failed to move inline event bodies: %v", err)
+		}
+		if moved > 0 {
+			log.Printf("moved bodies of %d events to the bodies table", moved)
+		}
+	}()
+
+	eb := control.NewEventBus()
+	rec, err := control.NewRecordingState(store.DB, eb)
 	if err != nil {
 		log.Fatal("failed to initialize recording state: %w", err)
 	}
 
-	eb := control.NewEventBus()
-	rep := replay.NewReplayState()
-	api.RegisterRoutes(app, store, rec, rep, eb)
+	pb, err := control.NewPlaybackState(store.DB)
+	if err != nil {
+		log.Fatal("failed to initialize playback state: %w", err)
+	}
+
+	ca, err := certs.LoadOrCreateCA(certs.DirFromEnv())
+	if err != nil {
+		log.Fatal("failed to initialize proxy CA: %w", err)
+	}
+
+	v, err := vault.FromEnv()
+	if err != nil {
+		log.Fatal("failed to initialize vault: %w", err)
+	}
+
+	reg, err := replay.NewRegistry(store.DB)
+	if err != nil {
+		log.Fatal("failed to initialize replay registry: %w", err)
+	}
+	rj := control.NewRedactionJobs(store.DB, eb, v)
+	proxies := proxy.NewManagerFromEnv(store.DB, rec, pb, eb, ca, v)
+	api.RegisterRoutes(app, store, rec, pb, reg, eb, ca, v, rj, proxies, proxies.Shared.Upstreams)
 
-	proxyListener := proxy.NewListenerFromEnv(store.DB, rec, eb)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go func() {
-		if err := proxyListener.Start(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := proxies.Start(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Printf("proxy failed: %v", err)
 		}
 	}()
-	log.Printf("Proxy Started on: %s", proxyListener.Addr)
+	log.Printf("Proxy Started on: %s", proxies.Shared.Addr)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -3,21 +3,26 @@ package api
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
+	"github.com/shigawire-dev/internal/certs"
 	"github.com/shigawire-dev/internal/control"
 	"github.com/shigawire-dev/internal/handlers"
 	"github.com/shigawire-dev/internal/replay"
 	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/upstream"
+	"github.com/shigawire-dev/internal/vault"
 )
 
 // RegisterRoutes sets up all HTTP routes for the API
-func RegisterRoutes(app *fiber.App, st *store.Store, rec *control.RecordingState, rep *replay.ReplayState, eb *control.EventBus) {
+func RegisterRoutes(app *fiber.App, st *store.Store, rec *control.RecordingState, pb *control.PlaybackState, reg *replay.Registry, eb *control.EventBus, ca *certs.CA, v *vault.Vault, rj *control.RedactionJobs, pl handlers.ProjectListeners, up *upstream.Pool) {
 	v1 := app.Group("/api/v1")
 
-	ph := handlers.NewProjectHandler(st)
-	sh := handlers.NewSessionHandler(st, rec, eb)
+	ph := handlers.NewProjectHandler(st, pb, pl, v)
+	sh := handlers.NewSessionHandler(st, rec, pb, eb)
 	eh := handlers.NewEventHandler(st)
 	dh := handlers.NewDocsHandler(st)
-	rh := handlers.NewReplayHandler(st, rep, rec)
+	ch := handlers.NewCAHandler(ca)
+	rh := handlers.NewReplayHandler(st, reg, rec, v, up)
+	xh := handlers.NewRedactionHandler(st, rj)
 
 	v1.Post("/projects", ph.CreateProject)
 	v1.Get("/projects", ph.ListProjects)
@@ -35,12 +40,23 @@ func RegisterRoutes(app *fiber.App, st *store.Store, rec *control.RecordingState
 	v1.Post("/projects/:projectId/sessions/:sessionId/capture/stop", sh.StopCapture)
 	v1.Get("/projects/:projectId/sessions/:sessionId/record/status", sh.RecordingStatus)
 
+	v1.Post("/projects/:projectId/sessions/:sessionId/playback/start", sh.StartPlayback)
+	v1.Post("/projects/:projectId/sessions/:sessionId/playback/stop", sh.StopPlayback)
+
 	v1.Get("/record/status", sh.GlobalRecordingStatus)
+	v1.Get("/playback/status", sh.GlobalPlaybackStatus)
 	v1.Get("/record/stream", sh.RecordStatusStream)
 	v1.Get("/events/stream", sh.EventStream)
 
 	v1.Get("/projects/:projectId/sessions/:sessionId/events", eh.ListEvents)
 	v1.Post("/projects/:projectId/sessions/:sessionId/events", eh.SeedEvent)
+	v1.Get("/projects/:projectId/sessions/:sessionId/events/:eventId/frames", eh.ListFrames)
+
+	v1.Post("/projects/:projectId/redaction/reapply", xh.ReapplyProject)
+	v1.Post("/projects/:projectId/sessions/:sessionId/redaction/reapply", xh.ReapplySession)
+	v1.Get("/redaction/jobs/:jobId", xh.GetJob)
+	v1.Post("/redaction/preview", xh.PreviewDefault)
+	v1.Post("/projects/:projectId/redaction/preview", xh.PreviewProject)
 
 	v1.Post("/projects/:projectId/sessions/:sessionId/replay/start", rh.StartReplay)
 	v1.Post("/projects/:projectId/sessions/:sessionId/replay/:replayId/stop", rh.StopReplay)
@@ -48,6 +64,10 @@ func RegisterRoutes(app *fiber.App, st *store.Store, rec *control.RecordingState
 	v1.Post("/projects/:projectId/sessions/:sessionId/replay/:replayId/resume", rh.ResumeReplay)
 	v1.Post("/projects/:projectId/sessions/:sessionId/replay/:replayId/step", rh.StepReplay)
 	v1.Get("/projects/:projectId/sessions/:sessionId/replay/:replayId/status", rh.GetReplayStatus)
+	v1.Get("/projects/:projectId/sessions/:sessionId/replay/:replayId/diffs", rh.GetReplayDiffs)
+
+	v1.Get("/projects/:projectId/sessions/:sessionId/replays", rh.ListReplayRuns)
+	v1.Get("/projects/:projectId/sessions/:sessionId/replays/:replayId", rh.GetReplayRun)
 
 	// WebSocket upgrade middleware must be registered on app (not group) before the handler
 	app.Use("/api/v1/replay/:replayId/ws", func(c *fiber.Ctx) error {
@@ -58,6 +78,8 @@ func RegisterRoutes(app *fiber.App, st *store.Store, rec *control.RecordingState
 	})
 	app.Get("/api/v1/replay/:replayId/ws", websocket.New(rh.ReplayEvents))
 
+	v1.Get("/proxy/ca.pem", ch.GetCACertificate)
+
 	v1.Get("/swagger/*", dh.GetSwaggerSpecification)
 	v1.Get("/openapi.yaml", dh.GetOpenAPISpec)
 }
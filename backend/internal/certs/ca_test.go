@@ -0,0 +1,51 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+)
+
+func TestLoadOrCreateCA(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ca.CertPEM(), again.CertPEM()) {
+		t.Error("a second start generated a new CA")
+	}
+}
+
+func TestCertificateFor(t *testing.T) {
+	ca, err := LoadOrCreateCA(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca.CertPEM()) {
+		t.Fatal("CA PEM has no certificate")
+	}
+
+	for _, host := range []string{"api.example.com", "127.0.0.1"} {
+		leaf, err := ca.CertificateFor(host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := x509.VerifyOptions{
+			DNSName:   host,
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if _, err := leaf.Leaf.Verify(opts); err != nil {
+			t.Errorf("%s: %v", host, err)
+		}
+		if again, _ := ca.CertificateFor(host); again != leaf {
+			t.Errorf("%s: certificate was not cached", host)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package contentcoding decodes HTTP bodies sent with a Content-Encoding.
+package contentcoding
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrTooLarge is returned when a decoded body is longer than the limit.
+var ErrTooLarge = errors.New("decoded body exceeds limit")
+
+// Codings lists the content codings of a Content-Encoding header value in the
+// order they were applied, leaving out "identity".
+func Codings(header string) []string {
+	var out []string
+	for _, c := range strings.Split(header, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c != "" && c != "identity" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Decode undoes every coding in header (gzip, x-gzip, deflate, br, zstd) and
+// returns at most limit decoded bytes; longer bodies fail with ErrTooLarge so
+// that a small compressed body can't expand without bound.
+func Decode(body []byte, header string, limit int) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(body), header)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > limit {
+		return nil, ErrTooLarge
+	}
+	return decoded, nil
+}
+
+// NewReader returns a reader that undoes every coding in header while body is
+// streamed through it. Closing it releases the decoders, not body.
+func NewReader(body io.Reader, header string) (io.ReadCloser, error) {
+	d := &decoder{Reader: body}
+	codings := Codings(header)
+	for i := len(codings) - 1; i >= 0; i-- {
+		r, err := newReader(codings[i], d.Reader)
+		if err != nil {
+			_ = d.Close()
+			return nil, err
+		}
+		d.Reader = &codingReader{coding: codings[i], r: r}
+		if c, ok := r.(io.Closer); ok {
+			d.closers = append(d.closers, c)
+		}
+	}
+	return d, nil
+}
+
+type decoder struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decoder) Close() error {
+	for _, c := range d.closers {
+		_ = c.Close()
+	}
+	return nil
+}
+
+// codingReader names the coding in read errors.
+type codingReader struct {
+	coding string
+	r      io.Reader
+}
+
+func (c *codingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("decode %s: %w", c.coding, err)
+	}
+	return n, err
+}
+
+func newReader(coding string, body io.Reader) (io.Reader, error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("decode gzip: %w", err)
+		}
+		return r, nil
+	case "deflate":
+		// "deflate" is specified as zlib-wrapped, but some servers send raw
+		// deflate data.
+		br := bufio.NewReader(body)
+		if hdr, err := br.Peek(2); err == nil && isZlibHeader(hdr) {
+			r, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("decode deflate: %w", err)
+			}
+			return r, nil
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return brotli.NewReader(body), nil
+	case "zstd":
+		d, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("decode zstd: %w", err)
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported content coding %q", coding)
+}
+
+// isZlibHeader checks the compression method and check bits of RFC 1950.
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
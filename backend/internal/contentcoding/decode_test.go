@@ -0,0 +1,148 @@
+package contentcoding
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func encode(t *testing.T, coding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	default:
+		t.Fatalf("unknown coding %q", coding)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCodings(t *testing.T) {
+	got := Codings(" GZIP, identity,br ,,")
+	if want := []string{"gzip", "br"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Codings = %v, want %v", got, want)
+	}
+	if got := Codings("identity"); got != nil {
+		t.Errorf("Codings(identity) = %v, want none", got)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	plain := []byte(strings.Repeat(`{"hello":"world"}`, 100))
+	cases := []struct {
+		header string
+		body   []byte
+	}{
+		{"gzip", encode(t, "gzip", plain)},
+		{"x-gzip", encode(t, "gzip", plain)},
+		{"deflate", encode(t, "deflate", plain)},
+		{"deflate", encode(t, "raw-deflate", plain)},
+		{"br", encode(t, "br", plain)},
+		{"zstd", encode(t, "zstd", plain)},
+		{"identity", plain},
+		{"", plain},
+	}
+	for _, c := range cases {
+		got, err := Decode(c.body, c.header, len(plain))
+		if err != nil {
+			t.Errorf("Decode(%q): %v", c.header, err)
+			continue
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("Decode(%q) = %q", c.header, got)
+		}
+	}
+}
+
+func TestDecodeStacked(t *testing.T) {
+	plain := []byte("stacked codings are undone in reverse order")
+	// "gzip, br" means gzip was applied first, then br.
+	body := encode(t, "br", encode(t, "gzip", plain))
+	got, err := Decode(body, "gzip, br", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("Decode = %q, want %q", got, plain)
+	}
+
+	if _, err := Decode(body, "br, gzip", 1024); err == nil {
+		t.Error("Decode in the wrong order succeeded")
+	}
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	plain := bytes.Repeat([]byte("a"), 10000)
+	body := encode(t, "gzip", plain)
+
+	if _, err := Decode(body, "gzip", len(plain)-1); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode over the limit: err = %v, want ErrTooLarge", err)
+	}
+	if got, err := Decode(body, "gzip", len(plain)); err != nil || len(got) != len(plain) {
+		t.Errorf("Decode at the limit = %d bytes, %v", len(got), err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode([]byte("x"), "compress", 10); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("unsupported coding: err = %v", err)
+	}
+	if _, err := Decode([]byte("not gzip"), "gzip", 10); err == nil {
+		t.Error("invalid gzip body decoded")
+	}
+
+	truncated := encode(t, "zstd", bytes.Repeat([]byte("abc"), 1000))
+	truncated = truncated[:len(truncated)/2]
+	if _, err := Decode(truncated, "zstd", 1<<20); err == nil || !strings.Contains(err.Error(), "decode zstd") {
+		t.Errorf("truncated zstd body: err = %v", err)
+	}
+}
+
+func TestNewReaderStreams(t *testing.T) {
+	plain := []byte("streamed through the decoder")
+	r, err := NewReader(bytes.NewReader(encode(t, "zstd", encode(t, "deflate", plain))), "deflate, zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("read %q, want %q", got, plain)
+	}
+}
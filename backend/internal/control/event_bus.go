@@ -4,15 +4,28 @@ import (
 	"sync"
 
 	"github.com/google/uuid"
+	"github.com/shigawire-dev/internal/models"
+)
+
+// Notification types carried by EventNotification.Type. Captured events leave
+// Type empty.
+const (
+	NotificationRedactionJob = "redaction_job"
+	// Sent with the full list whenever a recording starts or stops.
+	NotificationRecordings = "recordings"
 )
 
 type EventNotification struct {
+	Type       string `json:"type,omitempty"`
 	SessionID  string `json:"session_id"`
 	EventID    string `json:"event_id"`
 	Method     string `json:"method"`
 	URL        string `json:"url"`
 	Status     int    `json:"status"`
 	TotalCount int    `json:"total_count"`
+
+	RedactionJob *RedactionJobStatus `json:"redaction_job,omitempty"`
+	Recordings   []models.Recording  `json:"recordings,omitempty"`
 }
 
 type EventBus struct {
@@ -0,0 +1,90 @@
+package control
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/store"
+)
+
+// PlaybackState tracks the sealed sessions whose recorded responses the proxy
+// serves instead of forwarding to the upstream, at most one per project.
+type PlaybackState struct {
+	mu        sync.RWMutex
+	db        *sql.DB
+	playbacks map[string]models.Playback
+}
+
+func NewPlaybackState(db *sql.DB) (*PlaybackState, error) {
+	ps := &PlaybackState{db: db, playbacks: make(map[string]models.Playback)}
+
+	active, err := store.ListActivePlaybacks(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range active {
+		ps.playbacks[p.ProjectId] = p
+	}
+	return ps, nil
+}
+
+// Start plays back sessionId for its project, replacing the project's current
+// playback.
+func (s *PlaybackState) Start(projectId, sessionId string) (models.Playback, error) {
+	p := models.Playback{
+		ProjectId: projectId,
+		SessionId: sessionId,
+		StartedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := store.SetActivePlayback(s.db, p); err != nil {
+		return models.Playback{}, err
+	}
+	s.playbacks[projectId] = p
+	return p, nil
+}
+
+// Stop ends the playback of projectId, if it plays back.
+func (s *PlaybackState) Stop(projectId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.playbacks[projectId]; !ok {
+		return nil
+	}
+	if err := store.ClearActivePlayback(s.db, projectId); err != nil {
+		return err
+	}
+	delete(s.playbacks, projectId)
+	return nil
+}
+
+// Get returns the playback of projectId.
+func (s *PlaybackState) Get(projectId string) (models.Playback, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.playbacks[projectId]
+	return p, ok
+}
+
+// List returns the active playbacks, oldest first.
+func (s *PlaybackState) List() []models.Playback {
+	s.mu.RLock()
+	out := make([]models.Playback, 0, len(s.playbacks))
+	for _, p := range s.playbacks {
+		out = append(out, p)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].StartedAt != out[j].StartedAt {
+			return out[i].StartedAt < out[j].StartedAt
+		}
+		return out[i].ProjectId < out[j].ProjectId
+	})
+	return out
+}
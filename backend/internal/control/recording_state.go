@@ -2,72 +2,167 @@ package control
 
 import (
 	"database/sql"
+	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/shigawire-dev/internal/models"
 	"github.com/shigawire-dev/internal/store"
 )
 
+// RecordingState tracks the sessions that are recording. Several can record
+// at once; each proxied request goes to the one whose route matches it.
 type RecordingState struct {
-	mu        sync.RWMutex
-	db        *sql.DB
-	active    bool
-	projectId string
-	sessionId string
+	mu         sync.RWMutex
+	db         *sql.DB
+	eb         *EventBus
+	recordings map[string]models.Recording
 
 	subsMu      sync.Mutex
 	subscribers map[string]chan struct{}
 }
 
-func NewRecordingState(db *sql.DB) (*RecordingState, error) {
-	rs := &RecordingState{db: db}
+func NewRecordingState(db *sql.DB, eb *EventBus) (*RecordingState, error) {
+	rs := &RecordingState{db: db, eb: eb, recordings: make(map[string]models.Recording)}
 
-	projectId, sessionId, found, err := store.GetActiveRecording(db)
+	active, err := store.ListActiveRecordings(db)
 	if err != nil {
 		return nil, err
 	}
-	if found {
-		rs.active = true
-		rs.projectId = projectId
-		rs.sessionId = sessionId
+	for _, r := range active {
+		rs.recordings[r.SessionId] = r
 	}
 	return rs, nil
 }
 
-func (s *RecordingState) Start(projectId, sessionId string) error {
+// Start records sessionId on route, or moves its recording to route. Another
+// session of the project recording on the same route is stopped, since only
+// one of them could ever receive requests.
+func (s *RecordingState) Start(projectId, sessionId string, route models.RecordingRoute) (models.Recording, error) {
+	r := models.Recording{
+		ProjectId: projectId,
+		SessionId: sessionId,
+		Route:     route,
+		StartedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
 	s.mu.Lock()
-	err := store.SetActiveRecording(s.db, projectId, sessionId)
-	if err != nil {
+	for id, other := range s.recordings {
+		if id == sessionId || other.ProjectId != projectId || other.Route != route {
+			continue
+		}
+		if err := store.ClearActiveRecording(s.db, id); err != nil {
+			s.mu.Unlock()
+			return models.Recording{}, err
+		}
+		delete(s.recordings, id)
+	}
+	if err := store.SetActiveRecording(s.db, r); err != nil {
 		s.mu.Unlock()
-		return err
+		return models.Recording{}, err
 	}
-	s.active = true
-	s.projectId = projectId
-	s.sessionId = sessionId
+	s.recordings[sessionId] = r
 	s.mu.Unlock()
 	s.notifyChange()
-	return nil
+	return r, nil
 }
 
-func (s *RecordingState) Stop() error {
+// Stop ends the recording of sessionId, if it is recording.
+func (s *RecordingState) Stop(sessionId string) error {
 	s.mu.Lock()
-	err := store.ClearActiveRecording(s.db)
-	if err != nil {
+	if _, ok := s.recordings[sessionId]; !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	if err := store.ClearActiveRecording(s.db, sessionId); err != nil {
 		s.mu.Unlock()
 		return err
 	}
-	s.active = false
-	s.projectId = ""
-	s.sessionId = ""
+	delete(s.recordings, sessionId)
 	s.mu.Unlock()
 	s.notifyChange()
 	return nil
 }
 
-func (s *RecordingState) Get() (active bool, projectId, sessionId string) {
+// Get returns the recording of sessionId.
+func (s *RecordingState) Get(sessionId string) (models.Recording, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.recordings[sessionId]
+	return r, ok
+}
+
+// List returns the active recordings, oldest first.
+func (s *RecordingState) List() []models.Recording {
+	s.mu.RLock()
+	out := make([]models.Recording, 0, len(s.recordings))
+	for _, r := range s.recordings {
+		out = append(out, r)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].StartedAt != out[j].StartedAt {
+			return out[i].StartedAt < out[j].StartedAt
+		}
+		return out[i].SessionId < out[j].SessionId
+	})
+	return out
+}
+
+// Match returns the recording that captures r. The session header is checked
+// first, then the host, then the longest matching path prefix; a recording
+// with the default route takes everything else. When recordings of different
+// projects match equally, the newest one wins.
+func (s *RecordingState) Match(r *http.Request) (models.Recording, bool) {
+	return s.match(r, "")
+}
+
+// MatchProject is Match limited to the recordings of projectId.
+func (s *RecordingState) MatchProject(r *http.Request, projectId string) (models.Recording, bool) {
+	return s.match(r, projectId)
+}
+
+func (s *RecordingState) match(r *http.Request, projectId string) (models.Recording, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.active, s.projectId, s.sessionId
+
+	var byHeader, byHost, byPath, byDefault *models.Recording
+	header := r.Header.Get(models.SessionHeader)
+	for _, rec := range s.recordings {
+		if projectId != "" && rec.ProjectId != projectId {
+			continue
+		}
+		switch {
+		case rec.Route.MatchesHeader(header):
+			byHeader = newer(byHeader, &rec)
+		case rec.Route.MatchesHost(r.Host):
+			byHost = newer(byHost, &rec)
+		case rec.Route.MatchesPath(r.URL.Path):
+			if byPath == nil || len(rec.Route.Value) > len(byPath.Route.Value) {
+				byPath = &rec
+			} else if len(rec.Route.Value) == len(byPath.Route.Value) {
+				byPath = newer(byPath, &rec)
+			}
+		case rec.Route.Kind == models.RouteAll:
+			byDefault = newer(byDefault, &rec)
+		}
+	}
+	for _, rec := range []*models.Recording{byHeader, byHost, byPath, byDefault} {
+		if rec != nil {
+			return *rec, true
+		}
+	}
+	return models.Recording{}, false
+}
+
+func newer(cur, rec *models.Recording) *models.Recording {
+	if cur == nil || rec.StartedAt > cur.StartedAt {
+		return rec
+	}
+	return cur
 }
 
 func (s *RecordingState) Subscribe() (id string, updates <-chan struct{}) {
@@ -89,6 +184,13 @@ func (s *RecordingState) Unsubscribe(id string) {
 }
 
 func (s *RecordingState) notifyChange() {
+	if s.eb != nil {
+		s.eb.Publish(EventNotification{
+			Type:       NotificationRecordings,
+			Recordings: s.List(),
+		})
+	}
+
 	s.subsMu.Lock()
 	defer s.subsMu.Unlock()
 	for _, ch := range s.subscribers {
@@ -0,0 +1,340 @@
+package control
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/vault"
+)
+
+const (
+	RedactionJobRunning = "running"
+	RedactionJobDone    = "done"
+	RedactionJobFailed  = "failed"
+
+	// Progress is published on the event bus every this many events.
+	redactionJobProgressEvery = 50
+	// Finished jobs stay queryable for this long.
+	redactionJobRetention = 30 * time.Minute
+)
+
+// ErrRedactionJobRunning is returned when a project already has a job running.
+var ErrRedactionJobRunning = errors.New("a redaction job is already running for this project")
+
+// RedactionJobStatus is a snapshot of a job's progress.
+type RedactionJobStatus struct {
+	Id              string `json:"id"`
+	ProjectId       string `json:"project_id"`
+	SessionId       string `json:"session_id,omitempty"`
+	Status          string `json:"status"`
+	TotalEvents     int    `json:"total_events"`
+	ProcessedEvents int    `json:"processed_events"`
+	ChangedEvents   int    `json:"changed_events"`
+	ChangedFields   int    `json:"changed_fields"`
+	Error           string `json:"error,omitempty"`
+	StartedAt       string `json:"started_at"`
+	FinishedAt      string `json:"finished_at,omitempty"`
+}
+
+// RedactionJobs runs the project's current redaction policy over events that
+// were captured earlier, one background job at a time per project.
+type RedactionJobs struct {
+	mu    sync.Mutex
+	db    *sql.DB
+	eb    *EventBus
+	vault *vault.Vault
+	jobs  map[string]*RedactionJobStatus
+}
+
+func NewRedactionJobs(db *sql.DB, eb *EventBus, v *vault.Vault) *RedactionJobs {
+	return &RedactionJobs{db: db, eb: eb, vault: v, jobs: make(map[string]*RedactionJobStatus)}
+}
+
+// Start launches a job over every event of sessionId, or of every session in
+// projectId when sessionId is empty.
+func (j *RedactionJobs) Start(projectId, sessionId string) (RedactionJobStatus, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pruneLocked()
+	for _, job := range j.jobs {
+		if job.ProjectId == projectId && job.Status == RedactionJobRunning {
+			return RedactionJobStatus{}, ErrRedactionJobRunning
+		}
+	}
+
+	job := &RedactionJobStatus{
+		Id:        "redaction_job_" + uuid.NewString(),
+		ProjectId: projectId,
+		SessionId: sessionId,
+		Status:    RedactionJobRunning,
+		StartedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	j.jobs[job.Id] = job
+
+	go j.run(job)
+	return *job, nil
+}
+
+// Get returns a snapshot of the job, or false when it is unknown or expired.
+func (j *RedactionJobs) Get(id string) (RedactionJobStatus, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return RedactionJobStatus{}, false
+	}
+	return *job, true
+}
+
+func (j *RedactionJobs) pruneLocked() {
+	cutoff := time.Now().Add(-redactionJobRetention)
+	for id, job := range j.jobs {
+		if job.FinishedAt == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339Nano, job.FinishedAt); err == nil && t.Before(cutoff) {
+			delete(j.jobs, id)
+		}
+	}
+}
+
+func (j *RedactionJobs) run(job *RedactionJobStatus) {
+	err := j.process(job)
+
+	j.mu.Lock()
+	job.FinishedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	job.Status = RedactionJobDone
+	if err != nil {
+		job.Status = RedactionJobFailed
+		job.Error = err.Error()
+		log.Printf("redaction job %s failed: %v", job.Id, err)
+	}
+	j.mu.Unlock()
+
+	j.publish(job)
+}
+
+func (j *RedactionJobs) process(job *RedactionJobStatus) error {
+	policy, err := store.ProjectRedactionPolicy(j.db, job.ProjectId, j.vault != nil)
+	if err != nil {
+		return fmt.Errorf("load redaction policy: %w", err)
+	}
+
+	sessionIds := []string{job.SessionId}
+	if job.SessionId == "" {
+		sessions, err := store.ListSessionsByProject(j.db, job.ProjectId)
+		if err != nil {
+			return err
+		}
+		sessionIds = sessionIds[:0]
+		for _, s := range sessions {
+			sessionIds = append(sessionIds, s.Id)
+		}
+	}
+
+	eventsBySession := make(map[string][]*models.Event, len(sessionIds))
+	total := 0
+	for _, id := range sessionIds {
+		events, err := store.ListEventsBySession(j.db, id)
+		if err != nil {
+			return err
+		}
+		eventsBySession[id] = events
+		total += len(events)
+	}
+
+	j.mu.Lock()
+	job.TotalEvents = total
+	j.mu.Unlock()
+	j.publish(job)
+
+	for _, id := range sessionIds {
+		for _, e := range eventsBySession[id] {
+			fields, err := j.reapply(e, policy)
+			if err != nil {
+				return err
+			}
+
+			j.mu.Lock()
+			job.ProcessedEvents++
+			if fields > 0 {
+				job.ChangedEvents++
+				job.ChangedFields += fields
+			}
+			processed := job.ProcessedEvents
+			j.mu.Unlock()
+
+			if processed%redactionJobProgressEvery == 0 {
+				j.publish(job)
+			}
+		}
+	}
+	return nil
+}
+
+// reapply sanitizes a stored event and its WebSocket frames with policy and
+// saves whatever changed. It returns the number of newly redacted values.
+func (j *RedactionJobs) reapply(e *models.Event, policy redaction.Policy) (int, error) {
+	originals := make(map[string]string)
+	policy.Collect = func(placeholder, original string) {
+		originals[placeholder] = original
+	}
+	fields := 0
+	count := func() int {
+		n := len(originals)
+		fields += n
+		return n
+	}
+
+	var rules []string
+	add := func(applied []string) { rules = append(rules, applied...) }
+
+	url, applied := redaction.SanitizeURL(e.URL, policy)
+	add(applied)
+	reqHeaders, applied := resanitizeHeaders(e.ReqHeaders, policy)
+	add(applied)
+	respHeaders, applied := resanitizeHeaders(e.RespHeaders, policy)
+	add(applied)
+	reqBody, applied := resanitizeBody(e.ReqBody, e.ReqBodyEncoding, headerValue(e.ReqHeaders, "Content-Type"), "req", policy)
+	add(applied)
+	respBody, applied := resanitizeBody(e.RespBody, e.RespBodyEncoding, headerValue(e.RespHeaders, "Content-Type"), "resp", policy)
+	add(applied)
+
+	if count() > 0 {
+		e.URL, e.ReqHeaders, e.RespHeaders, e.ReqBody, e.RespBody = url, reqHeaders, respHeaders, reqBody, respBody
+		e.RedactionApplied = mergeRedactionNotes(e.RedactionApplied, rules)
+		if err := store.UpdateEventRedaction(j.db, e); err != nil {
+			return 0, err
+		}
+		j.storeOriginals(e, originals)
+	}
+
+	frames, err := store.ListWSFramesByEvent(j.db, e.Id)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range frames {
+		if f.PayloadEncoding != "text" || f.Payload == "" {
+			continue
+		}
+		clear(originals)
+		payload, applied := resanitizeBody(f.Payload, f.PayloadEncoding, "", "", policy)
+		if count() == 0 {
+			continue
+		}
+		f.Payload = payload
+		f.RedactionApplied = mergeRedactionNotes(f.RedactionApplied, applied)
+		if err := store.UpdateWSFrameRedaction(j.db, f); err != nil {
+			return 0, err
+		}
+		j.storeOriginals(e, originals)
+	}
+
+	return fields, nil
+}
+
+func (j *RedactionJobs) storeOriginals(e *models.Event, originals map[string]string) {
+	if j.vault == nil || len(originals) == 0 {
+		return
+	}
+	if err := j.vault.Store(j.db, e.SessionId, e.Id, originals); err != nil {
+		log.Printf("redaction job: failed to store redacted values in vault: %v", err)
+	}
+}
+
+func (j *RedactionJobs) publish(job *RedactionJobStatus) {
+	if j.eb == nil {
+		return
+	}
+	j.mu.Lock()
+	snapshot := *job
+	j.mu.Unlock()
+
+	j.eb.Publish(EventNotification{
+		Type:         NotificationRedactionJob,
+		RedactionJob: &snapshot,
+	})
+}
+
+func resanitizeHeaders(stored string, policy redaction.Policy) (string, []string) {
+	if stored == "" {
+		return stored, nil
+	}
+	var h http.Header
+	if err := json.Unmarshal([]byte(stored), &h); err != nil {
+		return stored, nil
+	}
+	sanitized, applied := redaction.SanitizeHeaders(h, policy)
+	b, err := json.Marshal(sanitized)
+	if err != nil {
+		return stored, nil
+	}
+	return string(b), applied
+}
+
+// resanitizeBody redacts a stored text body with the handler for its content
+// type. Bodies without a content type, such as WebSocket messages, are
+// redacted as JSON when they parse and with the value rules otherwise. A
+// stored body is never dropped, even if it no longer parses, and binary
+// bodies are left alone.
+func resanitizeBody(stored, encoding, contentType, direction string, policy redaction.Policy) (string, []string) {
+	if stored == "" || encoding == models.BodyEncodingBase64 {
+		return stored, nil
+	}
+	if contentType != "" {
+		sanitized, enc, applied := redaction.SanitizeBody(contentType, []byte(stored), direction, policy)
+		if sanitized != "" && enc == models.BodyEncodingText {
+			return sanitized, applied
+		}
+	}
+	if json.Valid([]byte(stored)) {
+		sanitized, applied, err := redaction.SanitizeJSON([]byte(stored), policy)
+		if err == nil {
+			return string(sanitized), applied
+		}
+	}
+	return redaction.SanitizeText(stored, policy)
+}
+
+// headerValue reads one header from a stored header set.
+func headerValue(stored, name string) string {
+	var h http.Header
+	if err := json.Unmarshal([]byte(stored), &h); err != nil {
+		return ""
+	}
+	return h.Get(name)
+}
+
+// mergeRedactionNotes appends rules not already listed in note, using the
+// "note; rule, rule" layout the proxy writes.
+func mergeRedactionNotes(note string, rules []string) string {
+	var missing []string
+	seen := make(map[string]struct{})
+	for _, r := range rules {
+		if _, dup := seen[r]; dup || strings.Contains(note, r) {
+			continue
+		}
+		seen[r] = struct{}{}
+		missing = append(missing, r)
+	}
+	if len(missing) == 0 {
+		return note
+	}
+	if note == "" {
+		return strings.Join(missing, ", ")
+	}
+	return note + ", " + strings.Join(missing, ", ")
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shigawire-dev/internal/certs"
+)
+
+type CAHandler struct {
+	ca *certs.CA
+}
+
+func NewCAHandler(ca *certs.CA) *CAHandler {
+	return &CAHandler{ca: ca}
+}
+
+// GetCACertificate serves the root certificate clients must trust for the
+// proxy to intercept their HTTPS traffic.
+func (h *CAHandler) GetCACertificate(c *fiber.Ctx) error {
+	c.Set("Content-Type", "application/x-pem-file")
+	c.Set("Content-Disposition", `attachment; filename="shigawire-ca.pem"`)
+	return c.Send(h.ca.CertPEM())
+}
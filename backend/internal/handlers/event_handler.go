@@ -101,3 +101,32 @@ func (h *EventHandler) SeedEvent(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusCreated).JSON(e)
 }
+
+// ListFrames returns the messages captured on a proxied WebSocket connection.
+func (h *EventHandler) ListFrames(c *fiber.Ctx) error {
+	projectId := c.Params("projectId")
+	sessionId := c.Params("sessionId")
+	eventId := c.Params("eventId")
+
+	s, err := store.GetSession(h.st.DB, sessionId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get session"})
+	}
+	if s == nil || s.ProjectId != projectId {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+
+	e, err := store.GetEvent(h.st.DB, eventId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get event"})
+	}
+	if e == nil || e.SessionId != sessionId {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "event not found"})
+	}
+
+	frames, err := store.ListWSFramesByEvent(h.st.DB, eventId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list frames"})
+	}
+	return c.JSON(frames)
+}
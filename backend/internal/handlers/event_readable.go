@@ -4,62 +4,76 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"mime"
-	"strconv"
 	"strings"
 
 	"github.com/shigawire-dev/internal/models"
 )
 
 type EventReadable struct {
-	Id                string              `json:"id"`
-	SessionId         string              `json:"session_id"`
-	Seq               int                 `json:"seq"`
-	StartedAt         string              `json:"started_at,omitempty"`
-	EndedAt           string              `json:"ended_at,omitempty"`
-	Method            string              `json:"method,omitempty"`
-	URL               string              `json:"url,omitempty"`
-	Status            int                 `json:"status,omitempty"`
-	ReqHeaders        map[string][]string `json:"req_headers,omitempty"`
-	RespHeaders       map[string][]string `json:"resp_headers,omitempty"`
-	ReqBody           string              `json:"req_body,omitempty"`           // readable text if textual
-	RespBody          string              `json:"resp_body,omitempty"`          // readable text if textual
-	ReqBodyEncoding   string              `json:"req_body_encoding,omitempty"`  // json|text|base64|empty
-	RespBodyEncoding  string              `json:"resp_body_encoding,omitempty"` // json|text|base64|empty
-	ReqBodyB64        string              `json:"req_body_b64,omitempty"`       // always available
-	RespBodyB64       string              `json:"resp_body_b64,omitempty"`      // always available
-	ReqBodyTruncated  bool                `json:"req_body_truncated,omitempty"`
-	RespBodyTruncated bool                `json:"resp_body_truncated,omitempty"`
-	RedactionApplied  string              `json:"redaction_applied,omitempty"`
+	Id                      string              `json:"id"`
+	SessionId               string              `json:"session_id"`
+	Seq                     int                 `json:"seq"`
+	StartedAt               string              `json:"started_at,omitempty"`
+	EndedAt                 string              `json:"ended_at,omitempty"`
+	Method                  string              `json:"method,omitempty"`
+	URL                     string              `json:"url,omitempty"`
+	Status                  int                 `json:"status,omitempty"`
+	ReqHeaders              map[string][]string `json:"req_headers,omitempty"`
+	RespHeaders             map[string][]string `json:"resp_headers,omitempty"`
+	ReqBody                 string              `json:"req_body,omitempty"`           // readable text if textual
+	RespBody                string              `json:"resp_body,omitempty"`          // readable text if textual
+	ReqBodyEncoding         string              `json:"req_body_encoding,omitempty"`  // json|text|base64|empty
+	RespBodyEncoding        string              `json:"resp_body_encoding,omitempty"` // json|text|base64|empty
+	ReqBodyB64              string              `json:"req_body_b64,omitempty"`       // always available
+	RespBodyB64             string              `json:"resp_body_b64,omitempty"`      // always available
+	ReqBodyTruncated        bool                `json:"req_body_truncated,omitempty"`
+	RespBodyTruncated       bool                `json:"resp_body_truncated,omitempty"`
+	ReqBodySize             int                 `json:"req_body_size,omitempty"`              // whole original body
+	RespBodySize            int                 `json:"resp_body_size,omitempty"`             // whole original body
+	ReqBodySHA256           string              `json:"req_body_sha256,omitempty"`            // whole original body
+	RespBodySHA256          string              `json:"resp_body_sha256,omitempty"`           // whole original body
+	ReqBodyContentEncoding  string              `json:"req_body_content_encoding,omitempty"`  // decoded from, e.g. gzip
+	RespBodyContentEncoding string              `json:"resp_body_content_encoding,omitempty"` // decoded from, e.g. gzip
+	RedactionApplied        string              `json:"redaction_applied,omitempty"`
+	UpstreamRoute           string              `json:"upstream_route,omitempty"`
 }
 
 func toReadableEvent(e *models.Event) EventReadable {
 	reqHeaders := parseStoredHeaders(e.ReqHeaders)
 	respHeaders := parseStoredHeaders(e.RespHeaders)
 
-	reqBody, reqEnc, reqB64 := decodeBodyForDisplay(e.ReqBody, reqHeaders)
-	respBody, respEnc, respB64 := decodeBodyForDisplay(e.RespBody, respHeaders)
+	reqBody, reqEnc, reqB64 := decodeBodyForDisplay(e.ReqBody, e.ReqBodyEncoding, e.ReqBodySize, e.ReqBodySHA256, reqHeaders)
+	respBody, respEnc, respB64 := decodeBodyForDisplay(e.RespBody, e.RespBodyEncoding, e.RespBodySize, e.RespBodySHA256, respHeaders)
 
 	return EventReadable{
-		Id:                e.Id,
-		SessionId:         e.SessionId,
-		Seq:               e.Seq,
-		StartedAt:         e.StartedAt,
-		EndedAt:           e.EndedAt,
-		Method:            e.Method,
-		URL:               e.URL,
-		Status:            e.Status,
-		ReqHeaders:        reqHeaders,
-		RespHeaders:       respHeaders,
-		ReqBody:           reqBody,
-		RespBody:          respBody,
-		ReqBodyEncoding:   reqEnc,
-		RespBodyEncoding:  respEnc,
-		ReqBodyB64:        reqB64,
-		RespBodyB64:       respB64,
-		ReqBodyTruncated:  isTruncated(e.ReqBody, reqHeaders),
-		RespBodyTruncated: isTruncated(e.RespBody, respHeaders),
-		RedactionApplied:  e.RedactionApplied,
+		Id:                      e.Id,
+		SessionId:               e.SessionId,
+		Seq:                     e.Seq,
+		StartedAt:               e.StartedAt,
+		EndedAt:                 e.EndedAt,
+		Method:                  e.Method,
+		URL:                     e.URL,
+		Status:                  e.Status,
+		ReqHeaders:              reqHeaders,
+		RespHeaders:             respHeaders,
+		ReqBody:                 reqBody,
+		RespBody:                respBody,
+		ReqBodyEncoding:         reqEnc,
+		RespBodyEncoding:        respEnc,
+		ReqBodyB64:              reqB64,
+		RespBodyB64:             respB64,
+		ReqBodyTruncated:        e.ReqBodyTruncated,
+		RespBodyTruncated:       e.RespBodyTruncated,
+		ReqBodySize:             e.ReqBodySize,
+		RespBodySize:            e.RespBodySize,
+		ReqBodySHA256:           e.ReqBodySHA256,
+		RespBodySHA256:          e.RespBodySHA256,
+		ReqBodyContentEncoding:  e.ReqBodyContentEncoding,
+		RespBodyContentEncoding: e.RespBodyContentEncoding,
+		RedactionApplied:        e.RedactionApplied,
+		UpstreamRoute:           e.UpstreamRoute,
 	}
 }
 
@@ -76,11 +90,16 @@ func parseStoredHeaders(raw string) map[string][]string {
 	return out
 }
 
-func decodeBodyForDisplay(body string, headers map[string][]string) (display string, encoding string, b64 string) {
+func decodeBodyForDisplay(body, storedEncoding string, size int, sha256 string, headers map[string][]string) (display string, encoding string, b64 string) {
 	if body == "" {
 		return "", "empty", ""
 	}
 
+	// Binary bodies are stored base64-encoded already; show a summary instead.
+	if storedEncoding == models.BodyEncodingBase64 {
+		return fmt.Sprintf("<binary body: %d bytes, sha256 %s>", size, sha256), "base64", body
+	}
+
 	b64 = base64.StdEncoding.EncodeToString([]byte(body))
 
 	ct := firstHeader(headers, "Content-Type")
@@ -110,15 +129,3 @@ func firstHeader(h map[string][]string, key string) string {
 	}
 	return ""
 }
-
-func isTruncated(body string, headers map[string][]string) bool {
-	clRaw := strings.TrimSpace(firstHeader(headers, "Content-Length"))
-	if clRaw == "" {
-		return false
-	}
-	cl, err := strconv.Atoi(clRaw)
-	if err != nil || cl <= 0 {
-		return false
-	}
-	return len(body) < cl
-}
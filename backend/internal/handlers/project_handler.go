@@ -6,16 +6,29 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/shigawire-dev/internal/control"
 	"github.com/shigawire-dev/internal/models"
 	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/vault"
 )
 
+// ProjectListeners starts and stops the proxy listeners of projects that
+// have their own listenPort.
+type ProjectListeners interface {
+	SyncProject(projectId string) error
+	RemoveProject(projectId string)
+}
+
 type ProjectHandler struct {
-	st *store.Store
+	st        *store.Store
+	pb        *control.PlaybackState
+	listeners ProjectListeners
+	// vault encrypts TLS client keys; without it projects can't have one.
+	vault *vault.Vault
 }
 
-func NewProjectHandler(st *store.Store) *ProjectHandler {
-	return &ProjectHandler{st: st}
+func NewProjectHandler(st *store.Store, pb *control.PlaybackState, listeners ProjectListeners, v *vault.Vault) *ProjectHandler {
+	return &ProjectHandler{st: st, pb: pb, listeners: listeners, vault: v}
 }
 
 type CreateProjectRequest struct {
@@ -40,10 +53,13 @@ func (h *ProjectHandler) CreateProject(c *fiber.Ctx) error {
 		cfg = json.RawMessage(`{}`)
 	}
 
-	normalized, err := models.NormalizeProjectConfig(string(cfg))
+	normalized, clientKey, err := models.NormalizeProjectConfig(string(cfg), "")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	if clientKey != "" && h.vault == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errClientKeyNeedsVault})
+	}
 
 	p := &models.Project{
 		Id:         models.GenerateProjectId(),
@@ -60,6 +76,15 @@ func (h *ProjectHandler) CreateProject(c *fiber.Ctx) error {
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create project"})
 	}
+	if err := h.saveClientKey(p.Id, clientKey, ""); err != nil {
+		_ = store.DeleteProject(h.st.DB, p.Id)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to store client key"})
+	}
+
+	if err := h.syncListener(p.Id); err != nil {
+		_ = store.DeleteProject(h.st.DB, p.Id)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(p)
 }
@@ -116,18 +141,40 @@ func (h *ProjectHandler) UpdateProject(c *fiber.Ctx) error {
 		cfg = json.RawMessage(existing.ConfigJSON)
 	}
 
-	normalized, err := models.NormalizeProjectConfig(string(cfg))
+	storedKey, err := h.vault.ClientKey(h.st.DB, projectId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load client key"})
+	}
+
+	normalized, clientKey, err := models.NormalizeProjectConfig(string(cfg), storedKey)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	if clientKey != "" && h.vault == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errClientKeyNeedsVault})
+	}
 
+	previous := *existing
 	existing.Name = name
 	existing.ConfigJSON = normalized
 
+	if err := h.saveClientKey(projectId, clientKey, storedKey); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to store client key"})
+	}
 	if err := store.UpdateProject(h.st.DB, existing); err != nil {
+		_ = h.saveClientKey(projectId, storedKey, clientKey)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update project"})
 	}
 
+	// A port that can't be bound leaves the project as it was.
+	if err := h.syncListener(projectId); err != nil {
+		if rerr := store.UpdateProject(h.st.DB, &previous); rerr == nil {
+			_ = h.saveClientKey(projectId, storedKey, clientKey)
+			_ = h.syncListener(projectId)
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	return c.JSON(existing)
 }
 
@@ -145,6 +192,30 @@ func (h *ProjectHandler) DeleteProject(c *fiber.Ctx) error {
 	if err := store.DeleteProject(h.st.DB, projectId); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to delete project"})
 	}
+	if err := h.pb.Stop(projectId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop playback state"})
+	}
+	if h.listeners != nil {
+		h.listeners.RemoveProject(projectId)
+	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+const errClientKeyNeedsVault = "config_json: tls.clientKeyPem needs VAULT_KEY to be set"
+
+// saveClientKey stores key as the project's TLS client key, if it isn't
+// already the stored one.
+func (h *ProjectHandler) saveClientKey(projectId, key, stored string) error {
+	if key == stored {
+		return nil
+	}
+	return h.vault.StoreClientKey(h.st.DB, projectId, key)
+}
+
+func (h *ProjectHandler) syncListener(projectId string) error {
+	if h.listeners == nil {
+		return nil
+	}
+	return h.listeners.SyncProject(projectId)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/proxy"
+	"github.com/shigawire-dev/internal/store"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func listening(port int) bool {
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(port), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func TestUpdateProjectPortConflict(t *testing.T) {
+	db, err := store.OpenDB(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := store.InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := freePort(t)
+	t.Setenv("PROXY_PORT", strconv.Itoa(shared))
+	m := proxy.NewManagerFromEnv(db, nil, nil, nil, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = m.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	for i := 0; !listening(shared); i++ {
+		if i == 50 {
+			t.Fatal("shared listener didn't start")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	h := NewProjectHandler(&store.Store{DB: db}, nil, m, nil)
+	app := fiber.New()
+	app.Post("/projects", h.CreateProject)
+	app.Put("/projects/:projectId", h.UpdateProject)
+	send := func(method, path, body string) (int, models.Project) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		var p models.Project
+		_ = json.Unmarshal(b, &p)
+		return resp.StatusCode, p
+	}
+	config := func(port int) string {
+		return fmt.Sprintf(`{"targetHost":"app","targetPort":80,"listenPort":%d}`, port)
+	}
+
+	own := freePort(t)
+	status, p := send(http.MethodPost, "/projects", `{"name":"a","config":`+config(own)+`}`)
+	if status != fiber.StatusCreated || !listening(own) {
+		t.Fatalf("create: status %d, listening %v", status, listening(own))
+	}
+	defer m.RemoveProject(p.Id)
+
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(freePort(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	taken := ln.Addr().(*net.TCPAddr).Port
+
+	// A port that can't be bound leaves the project and its listener as
+	// they were.
+	if status, _ := send(http.MethodPut, "/projects/"+p.Id, `{"config":`+config(taken)+`}`); status != fiber.StatusConflict {
+		t.Errorf("update to a taken port: status %d, want 409", status)
+	}
+	stored, err := store.GetProject(db, p.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ConfigJSON != p.ConfigJSON || !listening(own) {
+		t.Errorf("after the conflict: config %s, listening on %d %v", stored.ConfigJSON, own, listening(own))
+	}
+
+	if status, _ := send(http.MethodPut, "/projects/"+p.Id, `{"config":`+config(shared)+`}`); status != fiber.StatusConflict {
+		t.Errorf("update to the shared port: status %d, want 409", status)
+	}
+}
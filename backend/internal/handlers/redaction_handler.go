@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/shigawire-dev/internal/control"
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+	"github.com/shigawire-dev/internal/store"
+)
+
+type RedactionHandler struct {
+	st   *store.Store
+	jobs *control.RedactionJobs
+}
+
+func NewRedactionHandler(st *store.Store, jobs *control.RedactionJobs) *RedactionHandler {
+	return &RedactionHandler{st: st, jobs: jobs}
+}
+
+// ReapplyProject re-runs the project's current redaction policy over every
+// stored event of the project in a background job.
+func (h *RedactionHandler) ReapplyProject(c *fiber.Ctx) error {
+	p, err := store.GetProject(h.st.DB, c.Params("projectId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get project"})
+	}
+	if p == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+	}
+	return h.start(c, p.Id, "")
+}
+
+// ReapplySession is ReapplyProject limited to one session.
+func (h *RedactionHandler) ReapplySession(c *fiber.Ctx) error {
+	s, err := store.GetSession(h.st.DB, c.Params("sessionId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get session"})
+	}
+	if s == nil || s.ProjectId != c.Params("projectId") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	return h.start(c, s.ProjectId, s.Id)
+}
+
+func (h *RedactionHandler) start(c *fiber.Ctx, projectId, sessionId string) error {
+	job, err := h.jobs.Start(projectId, sessionId)
+	if errors.Is(err, control.ErrRedactionJobRunning) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to start redaction job"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+func (h *RedactionHandler) GetJob(c *fiber.Ctx) error {
+	job, ok := h.jobs.Get(c.Params("jobId"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "redaction job not found"})
+	}
+	return c.JSON(job)
+}
+
+// PreviewRedactionRequest is a request or response to run through redaction
+// without storing anything. Policy, in the same shape as the "redaction"
+// section of a project's config_json, replaces the saved policy.
+type PreviewRedactionRequest struct {
+	URL         string      `json:"url"`
+	Headers     http.Header `json:"headers"`
+	Body        string      `json:"body"`
+	ContentType string      `json:"content_type"`
+	// Direction is "req" (default) or "resp"; it only shows in skip notes.
+	Direction string                  `json:"direction"`
+	Policy    *models.RedactionConfig `json:"policy"`
+}
+
+type PreviewRedactionResponse struct {
+	URL     string      `json:"url,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body"`
+	// BodyEncoding is "text", or "base64" for a binary body returned as is.
+	BodyEncoding string              `json:"body_encoding,omitempty"`
+	Applied      []string            `json:"applied"`
+	Findings     []redaction.Finding `json:"findings"`
+}
+
+// PreviewDefault runs the built-in policy, or the candidate policy in the
+// request, over the request's URL, headers and body.
+func (h *RedactionHandler) PreviewDefault(c *fiber.Ctx) error {
+	return h.preview(c, "")
+}
+
+// PreviewProject is PreviewDefault with the project's saved policy as the
+// fallback. A candidate policy that enables tokenize uses the project's key.
+func (h *RedactionHandler) PreviewProject(c *fiber.Ctx) error {
+	p, err := store.GetProject(h.st.DB, c.Params("projectId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get project"})
+	}
+	if p == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+	}
+	return h.preview(c, p.Id)
+}
+
+func (h *RedactionHandler) preview(c *fiber.Ctx, projectId string) error {
+	var req PreviewRedactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid JSON"})
+	}
+
+	direction := req.Direction
+	if direction == "" {
+		direction = "req"
+	}
+	if direction != "req" && direction != "resp" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "direction must be req or resp"})
+	}
+
+	policy := redaction.DefaultPolicy
+	switch {
+	case req.Policy != nil:
+		rc, err := models.NormalizeRedactionConfig(req.Policy)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if policy, err = rc.Policy(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if rc.Tokenize && projectId != "" {
+			if policy.TokenKey, err = store.GetOrCreateRedactionKey(h.st.DB, projectId); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load redaction key"})
+			}
+		}
+	case projectId != "":
+		var err error
+		if policy, err = store.ProjectRedactionPolicy(h.st.DB, projectId, false); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load redaction policy"})
+		}
+	}
+
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = req.Headers.Get("Content-Type")
+	}
+
+	var out PreviewRedactionResponse
+	var applied []string
+	if req.URL != "" {
+		out.URL, applied = redaction.SanitizeURL(req.URL, policy)
+		out.Applied = append(out.Applied, applied...)
+	}
+	out.Headers, applied = redaction.SanitizeHeaders(req.Headers, policy)
+	out.Applied = append(out.Applied, applied...)
+	out.Body, out.BodyEncoding, applied = redaction.SanitizeBody(contentType, []byte(req.Body), direction, policy)
+	out.Applied = append(out.Applied, applied...)
+
+	if out.Applied == nil {
+		out.Applied = []string{}
+	}
+	out.Findings = make([]redaction.Finding, 0, len(out.Applied))
+	for _, note := range out.Applied {
+		out.Findings = append(out.Findings, redaction.ParseFinding(note))
+	}
+	return c.JSON(out)
+}
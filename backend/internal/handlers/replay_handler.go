@@ -2,40 +2,67 @@ package handlers
 
 import (
 	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
 	"github.com/shigawire-dev/internal/control"
+	"github.com/shigawire-dev/internal/models"
 	"github.com/shigawire-dev/internal/replay"
 	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/upstream"
+	"github.com/shigawire-dev/internal/vault"
 )
 
 type ReplayHandler struct {
-	st  *store.Store
-	rep *replay.ReplayState
-	rec *control.RecordingState
+	st        *store.Store
+	reg       *replay.Registry
+	rec       *control.RecordingState
+	vault     *vault.Vault
+	upstreams *upstream.Pool
 }
 
-func NewReplayHandler(st *store.Store, rep *replay.ReplayState, rec *control.RecordingState) *ReplayHandler {
-	return &ReplayHandler{st: st, rep: rep, rec: rec}
+func NewReplayHandler(st *store.Store, reg *replay.Registry, rec *control.RecordingState, v *vault.Vault, upstreams *upstream.Pool) *ReplayHandler {
+	return &ReplayHandler{st: st, reg: reg, rec: rec, vault: v, upstreams: upstreams}
+}
+
+// findReplay returns the live state for replayId, or nil when it is unknown,
+// already stopped, or belongs to a different session. An empty sessionId skips
+// the session check.
+func (h *ReplayHandler) findReplay(replayId, sessionId string) *replay.ReplayState {
+	state := h.reg.Get(replayId)
+	if state == nil {
+		return nil
+	}
+	status, _, stateSessionId, _, _ := state.Get()
+	if status == replay.StatusIdle || (sessionId != "" && stateSessionId != sessionId) {
+		return nil
+	}
+	return state
 }
 
 type StartReplayRequest struct {
 	Speed float64 `json:"speed"`
+	// Target overrides the project's upstream base URL, e.g. to replay against a new build.
+	Target string `json:"target"`
 }
 
 func (h *ReplayHandler) StartReplay(c *fiber.Ctx) error {
+	projectId := c.Params("projectId")
 	sessionId := c.Params("sessionId")
 
 	s, err := store.GetSession(h.st.DB, sessionId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get session"})
 	}
-	if s == nil {
+	if s == nil || s.ProjectId != projectId {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
 	}
-	if active, _, activeSessionId := h.rec.Get(); active && activeSessionId == sessionId {
+	if _, recording := h.rec.Get(sessionId); recording {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is currently recording"})
 	}
 
@@ -51,44 +78,104 @@ func (h *ReplayHandler) StartReplay(c *fiber.Ctx) error {
 		speed = 1.0
 	}
 
+	p, err := store.GetProject(h.st.DB, s.ProjectId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get project"})
+	}
+	if p == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+	}
+	cfg, err := store.GetProjectConfig(h.st.DB, s.ProjectId)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	policy, err := store.ProjectRedactionPolicy(h.st.DB, s.ProjectId, h.vault != nil)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load redaction policy"})
+	}
+
+	target := strings.TrimSpace(req.Target)
+	explicitTarget := target != ""
+	if explicitTarget {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "target must be an absolute http or https URL"})
+		}
+	} else {
+		target = cfg.UpstreamBaseUrl()
+	}
+
+	// The project's TLS settings, client key included, are only for its own
+	// upstreams; an explicit target is reached with the default ones.
+	var client *http.Client
+	if !explicitTarget {
+		if client, err = h.upstreams.Client(s.ProjectId, cfg); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	events, err := store.ListEventsBySession(h.st.DB, sessionId)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load events"})
 	}
 
 	replayId := "replay_" + uuid.NewString()
-	h.rep.Start(replayId, sessionId, speed)
+	state, err := h.reg.Start(&models.ReplayRun{
+		Id:          replayId,
+		ProjectId:   s.ProjectId,
+		SessionId:   s.Id,
+		Target:      target,
+		Speed:       speed,
+		StartedAt:   time.Now().UTC().Format(time.RFC3339Nano),
+		TotalEvents: len(events),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to start replay"})
+	}
 	if len(events) > 0 {
-		h.rep.SetSeq(events[0].Seq)
+		state.SetSeq(events[0].Seq)
 	}
 
-	go replay.Run(replayId, events, h.rep)
+	// Without an explicit target, forward-proxied events go back to the host they were captured from,
+	// and the others through the project's routing table.
+	sender := replay.NewSender(h.st.DB, target, !explicitTarget)
+	if !explicitTarget {
+		sender.Routes = cfg.Routes
+		sender.Client.Transport = client.Transport
+		if client.Timeout > 0 {
+			sender.RequestTimeout = client.Timeout
+		}
+	}
+	sender.Vault = h.vault
+	go replay.Run(replayId, events, state, sender, policy)
 
-	log.Printf("replay started: id=%s session=%s events=%d speed=%.1fx", replayId, sessionId, len(events), speed)
+	log.Printf("replay started: id=%s session=%s target=%s events=%d speed=%.1fx", replayId, sessionId, target, len(events), speed)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"replay_id": replayId,
+		"target":    target,
 	})
 }
 
 func (h *ReplayHandler) StopReplay(c *fiber.Ctx) error {
 	replayId := c.Params("replayId")
-	status, currentId, _, _, _ := h.rep.Get()
-	if status == replay.StatusIdle || currentId != replayId {
+	state := h.findReplay(replayId, c.Params("sessionId"))
+	if state == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "replay not found"})
 	}
-	h.rep.Stop()
+	h.reg.Stop(replayId)
 	log.Printf("replay stopped: id=%s", replayId)
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 func (h *ReplayHandler) PauseReplay(c *fiber.Ctx) error {
 	replayId := c.Params("replayId")
-	status, currentId, _, _, _ := h.rep.Get()
-	if status == replay.StatusIdle || currentId != replayId {
+	state := h.findReplay(replayId, c.Params("sessionId"))
+	if state == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "replay not found"})
 	}
-	if err := h.rep.Pause(); err != nil {
+	if err := state.Pause(); err != nil {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
 	}
 	log.Printf("replay paused: id=%s", replayId)
@@ -97,11 +184,11 @@ func (h *ReplayHandler) PauseReplay(c *fiber.Ctx) error {
 
 func (h *ReplayHandler) ResumeReplay(c *fiber.Ctx) error {
 	replayId := c.Params("replayId")
-	status, currentId, _, _, _ := h.rep.Get()
-	if status == replay.StatusIdle || currentId != replayId {
+	state := h.findReplay(replayId, c.Params("sessionId"))
+	if state == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "replay not found"})
 	}
-	if err := h.rep.Resume(); err != nil {
+	if err := state.Resume(); err != nil {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
 	}
 	log.Printf("replay resumed: id=%s", replayId)
@@ -110,11 +197,11 @@ func (h *ReplayHandler) ResumeReplay(c *fiber.Ctx) error {
 
 func (h *ReplayHandler) StepReplay(c *fiber.Ctx) error {
 	replayId := c.Params("replayId")
-	status, currentId, _, _, _ := h.rep.Get()
-	if status == replay.StatusIdle || currentId != replayId {
+	state := h.findReplay(replayId, c.Params("sessionId"))
+	if state == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "replay not found"})
 	}
-	if err := h.rep.Step(); err != nil {
+	if err := state.Step(); err != nil {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
 	}
 	log.Printf("replay stepped: id=%s", replayId)
@@ -123,37 +210,91 @@ func (h *ReplayHandler) StepReplay(c *fiber.Ctx) error {
 
 func (h *ReplayHandler) GetReplayStatus(c *fiber.Ctx) error {
 	replayId := c.Params("replayId")
-	status, currentId, sessionId, currentSeq, speed := h.rep.Get()
-	if status == replay.StatusIdle || currentId != replayId {
+	state := h.findReplay(replayId, c.Params("sessionId"))
+	if state == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "replay not found"})
 	}
+	status, currentId, sessionId, currentSeq, speed := state.Get()
+	target, sent, failed := state.Progress()
 	return c.JSON(fiber.Map{
 		"replay_id":   currentId,
 		"session_id":  sessionId,
 		"status":      status,
 		"current_seq": currentSeq,
 		"speed":       speed,
+		"target":      target,
+		"sent":        sent,
+		"failed":      failed,
 	})
 }
 
+func (h *ReplayHandler) GetReplayDiffs(c *fiber.Ctx) error {
+	replayId := c.Params("replayId")
+	state := h.findReplay(replayId, c.Params("sessionId"))
+	if state == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "replay not found"})
+	}
+	return c.JSON(state.Diffs())
+}
+
+func (h *ReplayHandler) ListReplayRuns(c *fiber.Ctx) error {
+	projectId := c.Params("projectId")
+	sessionId := c.Params("sessionId")
+
+	s, err := store.GetSession(h.st.DB, sessionId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get session"})
+	}
+	if s == nil || s.ProjectId != projectId {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+
+	runs, err := store.ListReplayRunsBySession(h.st.DB, sessionId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list replay runs"})
+	}
+	return c.JSON(runs)
+}
+
+func (h *ReplayHandler) GetReplayRun(c *fiber.Ctx) error {
+	projectId := c.Params("projectId")
+	sessionId := c.Params("sessionId")
+	replayId := c.Params("replayId")
+
+	run, err := store.GetReplayRun(h.st.DB, replayId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get replay run"})
+	}
+	if run == nil || run.ProjectId != projectId || run.SessionId != sessionId {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "replay run not found"})
+	}
+
+	results, err := store.ListReplayResults(h.st.DB, replayId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list replay results"})
+	}
+	run.Results = results
+	return c.JSON(run)
+}
+
 // ReplayEvents upgrades to WebSocket and streams replay state changes to the client.
 // The replay keeps running if the client disconnects.
 func (h *ReplayHandler) ReplayEvents(c *websocket.Conn) {
 	replayId := c.Params("replayId")
 
-	status, currentId, _, _, _ := h.rep.Get()
-	if status == replay.StatusIdle || currentId != replayId {
+	state := h.findReplay(replayId, "")
+	if state == nil {
 		c.WriteMessage(websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "replay not found"))
 		return
 	}
 
-	subId, ch := h.rep.Subscribe()
-	defer h.rep.Unsubscribe(subId)
+	subId, ch := state.Subscribe()
+	defer state.Unsubscribe(subId)
 
 	log.Printf("replay ws connected: id=%s sub=%s", replayId, subId)
 
-	if err := c.WriteMessage(websocket.TextMessage, h.rep.WSSnapshot()); err != nil {
+	if err := c.WriteMessage(websocket.TextMessage, state.WSSnapshot()); err != nil {
 		return
 	}
 
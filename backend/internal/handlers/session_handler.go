@@ -18,86 +18,66 @@ import (
 type SessionHandler struct {
 	st  *store.Store
 	rec *control.RecordingState
+	pb  *control.PlaybackState
 	eb  *control.EventBus
 }
 
-func NewSessionHandler(st *store.Store, rec *control.RecordingState, eb *control.EventBus) *SessionHandler {
-	return &SessionHandler{st: st, rec: rec, eb: eb}
+func NewSessionHandler(st *store.Store, rec *control.RecordingState, pb *control.PlaybackState, eb *control.EventBus) *SessionHandler {
+	return &SessionHandler{st: st, rec: rec, pb: pb, eb: eb}
 }
 
 type CreateSessionRequest struct {
 	Name string `json:"name"`
 }
 
+// computeGlobalRecordingStatus lists the active recordings, stopping any whose
+// session or project has gone and fixing a recorded project id that no
+// longer matches the session. project_id and session_id describe the oldest
+// recording, for clients that only know about one.
 func (h *SessionHandler) computeGlobalRecordingStatus() (fiber.Map, error) {
-	active, projectId, sessionId := h.rec.Get()
-	if !active {
-		return fiber.Map{
-			"recording":  false,
-			"project_id": "",
-			"session_id": "",
-		}, nil
-	}
-
-	if projectId == "" || sessionId == "" {
-		if err := h.rec.Stop(); err != nil {
+	repaired := false
+	recordings := make([]models.Recording, 0)
+	for _, r := range h.rec.List() {
+		s, err := store.GetSession(h.st.DB, r.SessionId)
+		if err != nil {
 			return nil, err
 		}
-		return fiber.Map{
-			"recording":      false,
-			"project_id":     "",
-			"session_id":     "",
-			"state_repaired": true,
-			"message":        "recording state was invalid and has been reset",
-		}, nil
-	}
-
-	s, err := store.GetSession(h.st.DB, sessionId)
-	if err != nil {
-		return nil, err
-	}
-	if s == nil {
-		if err := h.rec.Stop(); err != nil {
-			return nil, err
+		if s != nil && s.ProjectId != r.ProjectId {
+			if r, err = h.rec.Start(s.ProjectId, r.SessionId, r.Route); err != nil {
+				return nil, err
+			}
 		}
-		return fiber.Map{
-			"recording":      false,
-			"project_id":     "",
-			"session_id":     "",
-			"state_repaired": true,
-			"message":        "active session not found; recording state reset",
-		}, nil
-	}
-
-	if s.ProjectId != projectId {
-		projectId = s.ProjectId
-		if err := h.rec.Start(projectId, sessionId); err != nil {
-			return nil, err
+		var p *models.Project
+		if s != nil {
+			if p, err = store.GetProject(h.st.DB, s.ProjectId); err != nil {
+				return nil, err
+			}
+		}
+		if p == nil {
+			if err := h.rec.Stop(r.SessionId); err != nil {
+				return nil, err
+			}
+			repaired = true
+			continue
 		}
+		recordings = append(recordings, r)
 	}
 
-	p, err := store.GetProject(h.st.DB, projectId)
-	if err != nil {
-		return nil, err
+	m := fiber.Map{
+		"recording":  len(recordings) > 0,
+		"project_id": "",
+		"session_id": "",
+		"recordings": recordings,
 	}
-	if p == nil {
-		if err := h.rec.Stop(); err != nil {
-			return nil, err
-		}
-		return fiber.Map{
-			"recording":      false,
-			"project_id":     "",
-			"session_id":     "",
-			"state_repaired": true,
-			"message":        "active project not found; recording state reset",
-		}, nil
+	if len(recordings) > 0 {
+		m["project_id"] = recordings[0].ProjectId
+		m["session_id"] = recordings[0].SessionId
 	}
-
-	return fiber.Map{
-		"recording":  true,
-		"project_id": projectId,
-		"session_id": sessionId,
-	}, nil
+	if repaired {
+		m["state_repaired"] = true
+		m["message"] = "recordings of missing sessions or projects were stopped"
+	}
+	return m, nil
 }
 
 func (h *SessionHandler) GlobalRecordingStatus(c *fiber.Ctx) error {
@@ -127,7 +107,7 @@ func (h *SessionHandler) RecordStatusStream(c *fiber.Ctx) error {
 			m, err := h.computeGlobalRecordingStatus()
 			if err != nil {
 				log.Printf("record stream compute: %v", err)
-				m = fiber.Map{"recording": false, "project_id": "", "session_id": ""}
+				m = fiber.Map{"recording": false, "project_id": "", "session_id": "", "recordings": []models.Recording{}}
 			}
 			b, err := json.Marshal(m)
 			if err != nil {
@@ -250,10 +230,13 @@ func (h *SessionHandler) DeleteSession(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
 	}
 
-	active, _, activeSessionId := h.rec.Get()
-	if active && activeSessionId == sessionId {
-		if err := h.rec.Stop(); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop recording state"})
+	if err := h.rec.Stop(sessionId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop recording state"})
+	}
+
+	if p, playing := h.pb.Get(projectId); playing && p.SessionId == sessionId {
+		if err := h.pb.Stop(projectId); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop playback state"})
 		}
 	}
 
@@ -264,6 +247,12 @@ func (h *SessionHandler) DeleteSession(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// StartRecordingRequest is the optional body of StartRecording. Without a
+// route the session records every request no other recording's route takes.
+type StartRecordingRequest struct {
+	Route models.RecordingRoute `json:"route"`
+}
+
 func (h *SessionHandler) StartRecording(c *fiber.Ctx) error {
 	projectId := c.Params("projectId")
 	sessionId := c.Params("sessionId")
@@ -278,17 +267,35 @@ func (h *SessionHandler) StartRecording(c *fiber.Ctx) error {
 	if s.Sealed {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot record: session is sealed"})
 	}
+	if p, playing := h.pb.Get(projectId); playing {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":               "playback is active for this project; stop it before recording",
+			"playback_session_id": p.SessionId,
+		})
+	}
+
+	var req StartRecordingRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid JSON"})
+		}
+	}
+	route, err := models.NormalizeRecordingRoute(req.Route, s.Id)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	if err := h.rec.Start(s.ProjectId, sessionId); err != nil {
+	r, err := h.rec.Start(s.ProjectId, s.Id, route)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to start recording"})
 	}
-	_ = store.TouchSessionUpdatedAt(h.st.DB, sessionId, time.Now().UTC().Format(time.RFC3339Nano))
-	projectId = s.ProjectId
+	_ = store.TouchSessionUpdatedAt(h.st.DB, s.Id, time.Now().UTC().Format(time.RFC3339Nano))
 
 	return c.JSON(fiber.Map{
 		"recording":  true,
-		"project_id": projectId,
-		"session_id": sessionId,
+		"project_id": r.ProjectId,
+		"session_id": r.SessionId,
+		"route":      r.Route,
 	})
 }
 
@@ -304,9 +311,8 @@ func (h *SessionHandler) RecordingStatus(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
 	}
 
-	active, activeProjectId, activeSessionId := h.rec.Get()
-	recording := active && activeProjectId == projectId && activeSessionId == sessionId
-	if !recording {
+	r, recording := h.rec.Get(sessionId)
+	if !recording || r.ProjectId != projectId {
 		return c.JSON(fiber.Map{
 			"recording":  false,
 			"project_id": projectId,
@@ -318,6 +324,7 @@ func (h *SessionHandler) RecordingStatus(c *fiber.Ctx) error {
 		"recording":  true,
 		"project_id": projectId,
 		"session_id": sessionId,
+		"route":      r.Route,
 	})
 }
 
@@ -334,19 +341,20 @@ func (h *SessionHandler) StopRecording(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
 	}
 
-	active, activeProjectId, activeSessionId := h.rec.Get()
-	if !active {
+	r, recording := h.rec.Get(sessionId)
+	if !recording {
 		return c.JSON(fiber.Map{
 			"recording": false,
 			"message":   "recording already stopped",
 		})
 	}
 
-	if activeSessionId == sessionId && activeProjectId != projectId {
+	if err := h.rec.Stop(sessionId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop recording state"})
+	}
+
+	if r.ProjectId != projectId {
 		// corrupted state: same session, wrong project id
-		if err := h.rec.Stop(); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop recording state"})
-		}
 		return c.JSON(fiber.Map{
 			"recording":      false,
 			"project_id":     projectId,
@@ -356,18 +364,6 @@ func (h *SessionHandler) StopRecording(c *fiber.Ctx) error {
 		})
 	}
 
-	if activeProjectId != projectId || activeSessionId != sessionId {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":             "another session is currently recording",
-			"active_project_id": activeProjectId,
-			"active_session_id": activeSessionId,
-		})
-	}
-
-	if err := h.rec.Stop(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop recording state"})
-	}
-
 	return c.JSON(fiber.Map{
 		"recording":  false,
 		"project_id": projectId,
@@ -394,11 +390,8 @@ func (h *SessionHandler) StopCapture(c *fiber.Ctx) error {
 		})
 	}
 
-	active, _, activeSessionId := h.rec.Get()
-	if active && activeSessionId == sessionId {
-		if err := h.rec.Stop(); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop recording state"})
-		}
+	if err := h.rec.Stop(sessionId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop recording state"})
 	}
 
 	if err := store.SealSession(h.st.DB, sessionId); err != nil {
@@ -411,6 +404,102 @@ func (h *SessionHandler) StopCapture(c *fiber.Ctx) error {
 	})
 }
 
+func (h *SessionHandler) StartPlayback(c *fiber.Ctx) error {
+	projectId := c.Params("projectId")
+	sessionId := c.Params("sessionId")
+
+	s, err := store.GetSession(h.st.DB, sessionId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get session"})
+	}
+	if s == nil || s.ProjectId != projectId {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	if !s.Sealed {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot play back: session is not sealed"})
+	}
+
+	recordings := make([]models.Recording, 0)
+	for _, r := range h.rec.List() {
+		if r.ProjectId == projectId {
+			recordings = append(recordings, r)
+		}
+	}
+	if len(recordings) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":             "a session of this project is currently recording",
+			"active_project_id": recordings[0].ProjectId,
+			"active_session_id": recordings[0].SessionId,
+			"recordings":        recordings,
+		})
+	}
+
+	if _, err := h.pb.Start(s.ProjectId, s.Id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to start playback"})
+	}
+
+	return c.JSON(fiber.Map{
+		"playback":   true,
+		"project_id": projectId,
+		"session_id": sessionId,
+	})
+}
+
+func (h *SessionHandler) StopPlayback(c *fiber.Ctx) error {
+	projectId := c.Params("projectId")
+	sessionId := c.Params("sessionId")
+
+	s, err := store.GetSession(h.st.DB, sessionId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get session"})
+	}
+	if s == nil || s.ProjectId != projectId {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+
+	p, active := h.pb.Get(projectId)
+	if !active {
+		return c.JSON(fiber.Map{
+			"playback": false,
+			"message":  "playback already stopped",
+		})
+	}
+	if p.SessionId != sessionId {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":             "another session of this project is currently playing back",
+			"active_project_id": p.ProjectId,
+			"active_session_id": p.SessionId,
+		})
+	}
+
+	if err := h.pb.Stop(projectId); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to stop playback state"})
+	}
+
+	return c.JSON(fiber.Map{
+		"playback":   false,
+		"project_id": projectId,
+		"session_id": sessionId,
+	})
+}
+
+// GlobalPlaybackStatus lists the active playbacks. project_id and session_id
+// describe the oldest one, for clients that only know about one.
+func (h *SessionHandler) GlobalPlaybackStatus(c *fiber.Ctx) error {
+	playbacks := h.pb.List()
+	m := fiber.Map{
+		"playback":   len(playbacks) > 0,
+		"project_id": "",
+		"session_id": "",
+		"playbacks":  playbacks,
+	}
+	if len(playbacks) > 0 {
+		m["project_id"] = playbacks[0].ProjectId
+		m["session_id"] = playbacks[0].SessionId
+	}
+	return c.JSON(m)
+}
+
 func (h *SessionHandler) EventStream(c *fiber.Ctx) error {
 	c.Set("Content-Type", "text/event-stream")
 	c.Set("Cache-Control", "no-cache")
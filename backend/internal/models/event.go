@@ -1,5 +1,18 @@
 package models
 
+import (
+	"encoding/base64"
+
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+// Encodings of a stored body. Events captured before encodings were recorded
+// have none and hold text.
+const (
+	BodyEncodingText   = redaction.BodyEncodingText
+	BodyEncodingBase64 = redaction.BodyEncodingBase64
+)
+
 type Event struct {
 	Id               string `json:"id"`
 	SessionId        string `json:"session_id"`
@@ -14,4 +27,35 @@ type Event struct {
 	ReqBody          string `json:"req_body,omitempty"`
 	RespBody         string `json:"resp_body,omitempty"`
 	RedactionApplied string `json:"redaction_applied,omitempty"`
+
+	// Bodies are stored as text, or base64-encoded when binary. Size and
+	// SHA-256 hex digest describe the whole original body, even when only
+	// part of it was stored; the digest is left out for fully stored bodies
+	// that had values redacted. Truncated is set when the stored body is a
+	// prefix of the original.
+	ReqBodyEncoding   string `json:"req_body_encoding,omitempty"`
+	RespBodyEncoding  string `json:"resp_body_encoding,omitempty"`
+	ReqBodySize       int    `json:"req_body_size,omitempty"`
+	RespBodySize      int    `json:"resp_body_size,omitempty"`
+	ReqBodySHA256     string `json:"req_body_sha256,omitempty"`
+	RespBodySHA256    string `json:"resp_body_sha256,omitempty"`
+	ReqBodyTruncated  bool   `json:"req_body_truncated,omitempty"`
+	RespBodyTruncated bool   `json:"resp_body_truncated,omitempty"`
+
+	// The Content-Encoding a body arrived with, when it was decoded before
+	// redaction and storage. The stored body is always the decoded one.
+	ReqBodyContentEncoding  string `json:"req_body_content_encoding,omitempty"`
+	RespBodyContentEncoding string `json:"resp_body_content_encoding,omitempty"`
+
+	// UpstreamRoute names the entry of the project's routing table that the
+	// request was sent through; empty for the project's own upstream.
+	UpstreamRoute string `json:"upstream_route,omitempty"`
+}
+
+// DecodeBody returns the bytes of a stored body.
+func DecodeBody(body, encoding string) ([]byte, error) {
+	if encoding == BodyEncodingBase64 {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
 }
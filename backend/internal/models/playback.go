@@ -0,0 +1,9 @@
+package models
+
+// Playback is a sealed session whose recorded responses answer its project's
+// proxied requests. Each project plays back at most one session.
+type Playback struct {
+	ProjectId string `json:"project_id"`
+	SessionId string `json:"session_id"`
+	StartedAt string `json:"started_at"`
+}
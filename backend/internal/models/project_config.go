@@ -4,12 +4,107 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+
+	"github.com/shigawire-dev/internal/redaction"
 )
 
 type ProjectConfig struct {
-	Scheme string `json:"scheme"`
-	Host   string `json:"host"`
-	Port   int    `json:"port"`
+	Scheme    string           `json:"scheme"`
+	Host      string           `json:"host"`
+	Port      int              `json:"port"`
+	Redaction redaction.Policy `json:"-"`
+	// TokenizeRedactions asks for the project's secret key to be added to
+	// Redaction; see store.ProjectRedactionPolicy.
+	TokenizeRedactions bool `json:"-"`
+	// MaxBodyBytes is how much of each body is stored; longer bodies are
+	// truncated.
+	MaxBodyBytes int `json:"-"`
+	// ListenPort is the project's own proxy port, or 0 when the project is
+	// only reachable through the shared one.
+	ListenPort int `json:"-"`
+	// Routes send requests for some paths to other upstreams; see
+	// MatchUpstreamRoute.
+	Routes []UpstreamRoute `json:"-"`
+	// TLS is nil when the upstreams are reached with the default settings.
+	TLS *UpstreamTLSConfig `json:"-"`
+	// Transport is nil when the upstreams are reached with the default
+	// timeouts and pooling.
+	Transport *TransportConfig `json:"-"`
+
+	upstreamSettings string
+}
+
+// UpstreamSettings identifies the TLS and transport settings of the config;
+// configs with the same settings can share their upstream connections.
+func (c *ProjectConfig) UpstreamSettings() string {
+	return c.upstreamSettings
+}
+
+// Limits on how much of a body is captured.
+const (
+	DefaultMaxBodyBytes = 64 * 1024
+	MaxBodyBytesLimit   = 8 * 1024 * 1024
+)
+
+// CaptureConfig is the "capture" section of a project's config_json.
+type CaptureConfig struct {
+	// MaxBodyBytes defaults to DefaultMaxBodyBytes.
+	MaxBodyBytes int `json:"maxBodyBytes,omitempty"`
+}
+
+// RedactionConfig is the "redaction" section of a project's config_json. The
+// listed headers and JSON keys are redacted in addition to the built-in
+// defaults, unless includeDefaults is explicitly false.
+type RedactionConfig struct {
+	HeaderDenylist  []string          `json:"headerDenylist,omitempty"`
+	JSONKeyDenylist []string          `json:"jsonKeyDenylist,omitempty"`
+	ValueRules      []ValueRuleConfig `json:"valueRules,omitempty"`
+	IncludeDefaults *bool             `json:"includeDefaults,omitempty"`
+	// DefaultValueRules turns on the jwt, bearer_token, credit_card and
+	// aws_key detectors.
+	DefaultValueRules bool `json:"defaultValueRules,omitempty"`
+	// Tokenize replaces values with "[REDACTED:<hmac>]" placeholders keyed by a
+	// per-project secret, so equal values get equal placeholders.
+	Tokenize bool `json:"tokenize,omitempty"`
+}
+
+// ValueRuleConfig selects a built-in detector ("jwt", "bearer_token",
+// "credit_card", "aws_key", "email") or a regular expression pattern.
+type ValueRuleConfig struct {
+	Name     string `json:"name,omitempty"`
+	Detector string `json:"detector,omitempty"`
+	Pattern  string `json:"pattern,omitempty"`
+}
+
+// Policy resolves the config into the policy applied to captured traffic.
+// A nil config yields the default policy.
+func (rc *RedactionConfig) Policy() (redaction.Policy, error) {
+	if rc == nil {
+		return redaction.DefaultPolicy, nil
+	}
+
+	var p redaction.Policy
+	if rc.IncludeDefaults == nil || *rc.IncludeDefaults {
+		p.HeaderDenylist = append(p.HeaderDenylist, redaction.DefaultPolicy.HeaderDenylist...)
+		p.JSONKeyDenylist = append(p.JSONKeyDenylist, redaction.DefaultPolicy.JSONKeyDenylist...)
+	}
+	if rc.DefaultValueRules {
+		p.ValueRules = append(p.ValueRules, redaction.DefaultValueRules...)
+	}
+	for _, name := range rc.HeaderDenylist {
+		p.HeaderDenylist = append(p.HeaderDenylist, redaction.HeaderRule{Name: name})
+	}
+	for _, key := range rc.JSONKeyDenylist {
+		p.JSONKeyDenylist = append(p.JSONKeyDenylist, redaction.JSONKeyRule{Key: key})
+	}
+	for i, vr := range rc.ValueRules {
+		rule, err := redaction.NewValueRule(vr.Name, vr.Detector, vr.Pattern)
+		if err != nil {
+			return redaction.Policy{}, fmt.Errorf("config_json: redaction.valueRules[%d]: %w", i, err)
+		}
+		p.ValueRules = append(p.ValueRules, rule)
+	}
+	return p, nil
 }
 
 func (c ProjectConfig) UpstreamBaseUrl() string {
@@ -24,12 +119,24 @@ type rawProjectConfig struct {
 	Scheme       string `json:"scheme"`
 	Host         string `json:"host"`
 	Port         int    `json:"port"`
+
+	Redaction *RedactionConfig `json:"redaction"`
+	Capture   *CaptureConfig   `json:"capture"`
+
+	ListenPort int                `json:"listenPort"`
+	Routes     []UpstreamRoute    `json:"routes"`
+	TLS        *UpstreamTLSConfig `json:"tls"`
+	Transport  *TransportConfig   `json:"transport"`
 }
 
-func NormalizeProjectConfig(configJSON string) (string, error) {
+// NormalizeProjectConfig validates a config and returns it in its stored
+// form. The TLS client key is returned apart, as it is not stored in the
+// config; clientKey is the key currently stored for the project, kept when
+// the config leaves tls.clientKeyPem out but keeps tls.hasClientKey.
+func NormalizeProjectConfig(configJSON, clientKey string) (string, string, error) {
 	var raw rawProjectConfig
 	if err := json.Unmarshal([]byte(configJSON), &raw); err != nil {
-		return "", fmt.Errorf("invalid config_json: %w", err)
+		return "", "", fmt.Errorf("invalid config_json: %w", err)
 	}
 
 	scheme := raw.TargetScheme
@@ -51,13 +158,36 @@ func NormalizeProjectConfig(configJSON string) (string, error) {
 	}
 
 	if scheme != "http" && scheme != "https" {
-		return "", fmt.Errorf("config_json: scheme must be http or https")
+		return "", "", fmt.Errorf("config_json: scheme must be http or https")
 	}
 	if host == "" {
-		return "", fmt.Errorf("config_json: host is required")
+		return "", "", fmt.Errorf("config_json: host is required")
 	}
 	if port <= 0 || port > 65535 {
-		return "", fmt.Errorf("config_json: port out of range")
+		return "", "", fmt.Errorf("config_json: port out of range")
+	}
+
+	rc, err := NormalizeRedactionConfig(raw.Redaction)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := captureMaxBodyBytes(raw.Capture); err != nil {
+		return "", "", err
+	}
+	if err := validateListenPort(raw.ListenPort); err != nil {
+		return "", "", err
+	}
+	routes, err := NormalizeUpstreamRoutes(raw.Routes)
+	if err != nil {
+		return "", "", err
+	}
+	tc, clientKey, err := NormalizeUpstreamTLSConfig(raw.TLS, clientKey)
+	if err != nil {
+		return "", "", err
+	}
+	transport, err := NormalizeTransportConfig(raw.Transport)
+	if err != nil {
+		return "", "", err
 	}
 
 	out := map[string]any{
@@ -66,8 +196,26 @@ func NormalizeProjectConfig(configJSON string) (string, error) {
 		"targetHost":   host,
 		"targetPort":   port,
 	}
+	if rc != nil {
+		out["redaction"] = rc
+	}
+	if raw.Capture != nil && raw.Capture.MaxBodyBytes != 0 {
+		out["capture"] = raw.Capture
+	}
+	if raw.ListenPort != 0 {
+		out["listenPort"] = raw.ListenPort
+	}
+	if len(routes) > 0 {
+		out["routes"] = routes
+	}
+	if tc != nil {
+		out["tls"] = tc
+	}
+	if transport != nil {
+		out["transport"] = transport
+	}
 	b, _ := json.Marshal(out)
-	return string(b), nil
+	return string(b), clientKey, nil
 }
 
 func ParseProjectConfig(configJSON string) (*ProjectConfig, error) {
@@ -92,9 +240,116 @@ func ParseProjectConfig(configJSON string) (*ProjectConfig, error) {
 		return nil, fmt.Errorf("config_json: port out of range")
 	}
 
+	// The rest was validated by NormalizeProjectConfig when the config was
+	// saved; only what is needed to use it is done again.
+	var err error
+	if cfg.Redaction, err = raw.Redaction.Policy(); err != nil {
+		return nil, err
+	}
+	cfg.TokenizeRedactions = raw.Redaction != nil && raw.Redaction.Tokenize
+	if cfg.MaxBodyBytes, err = captureMaxBodyBytes(raw.Capture); err != nil {
+		return nil, err
+	}
+	cfg.ListenPort = raw.ListenPort
+	if cfg.Routes, err = NormalizeUpstreamRoutes(raw.Routes); err != nil {
+		return nil, err
+	}
+	cfg.TLS = raw.TLS
+	cfg.Transport = raw.Transport
+	b, _ := json.Marshal([]any{cfg.TLS, cfg.Transport})
+	cfg.upstreamSettings = string(b)
+
 	return cfg, nil
 }
 
+// NormalizeRedactionConfig trims and de-duplicates the denylists and rejects
+// entries that could never match.
+func NormalizeRedactionConfig(in *RedactionConfig) (*RedactionConfig, error) {
+	if in == nil {
+		return nil, nil
+	}
+
+	out := &RedactionConfig{
+		IncludeDefaults:   in.IncludeDefaults,
+		DefaultValueRules: in.DefaultValueRules,
+		Tokenize:          in.Tokenize,
+	}
+
+	seenHeaders := make(map[string]struct{}, len(in.HeaderDenylist))
+	for _, name := range in.HeaderDenylist {
+		name = strings.TrimSpace(name)
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("config_json: redaction.headerDenylist: invalid header name %q", name)
+		}
+		key := strings.ToLower(name)
+		if _, dup := seenHeaders[key]; dup {
+			continue
+		}
+		seenHeaders[key] = struct{}{}
+		out.HeaderDenylist = append(out.HeaderDenylist, name)
+	}
+
+	seenKeys := make(map[string]struct{}, len(in.JSONKeyDenylist))
+	for _, k := range in.JSONKeyDenylist {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			return nil, fmt.Errorf("config_json: redaction.jsonKeyDenylist: keys must not be empty")
+		}
+		key := strings.ToLower(k)
+		if _, dup := seenKeys[key]; dup {
+			continue
+		}
+		seenKeys[key] = struct{}{}
+		out.JSONKeyDenylist = append(out.JSONKeyDenylist, k)
+	}
+
+	for i, vr := range in.ValueRules {
+		vr = ValueRuleConfig{
+			Name:     strings.TrimSpace(vr.Name),
+			Detector: strings.TrimSpace(vr.Detector),
+			Pattern:  vr.Pattern,
+		}
+		if _, err := redaction.NewValueRule(vr.Name, vr.Detector, vr.Pattern); err != nil {
+			return nil, fmt.Errorf("config_json: redaction.valueRules[%d]: %w", i, err)
+		}
+		out.ValueRules = append(out.ValueRules, vr)
+	}
+
+	return out, nil
+}
+
+// captureMaxBodyBytes resolves the body capture limit of a capture section.
+func captureMaxBodyBytes(cc *CaptureConfig) (int, error) {
+	if cc == nil || cc.MaxBodyBytes == 0 {
+		return DefaultMaxBodyBytes, nil
+	}
+	if cc.MaxBodyBytes < 0 || cc.MaxBodyBytes > MaxBodyBytesLimit {
+		return 0, fmt.Errorf("config_json: capture.maxBodyBytes must be between 1 and %d", MaxBodyBytesLimit)
+	}
+	return cc.MaxBodyBytes, nil
+}
+
+// validateListenPort accepts 0, meaning no project port, or a TCP port.
+func validateListenPort(port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("config_json: listenPort out of range")
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is an RFC 7230 token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 0x7e || r <= 0x20 || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if v != "" {
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+func TestRedactionConfigValueRules(t *testing.T) {
+	includeDefaults := false
+	cases := []struct {
+		name string
+		rc   *RedactionConfig
+		want []string
+	}{
+		{"no config", nil, nil},
+		{"defaults", &RedactionConfig{}, nil},
+		{"opted in", &RedactionConfig{DefaultValueRules: true}, []string{
+			redaction.DetectorJWT, redaction.DetectorBearerToken, redaction.DetectorCreditCard, redaction.DetectorAWSKey,
+		}},
+		{"own rules only", &RedactionConfig{
+			IncludeDefaults: &includeDefaults,
+			ValueRules:      []ValueRuleConfig{{Detector: redaction.DetectorEmail}},
+		}, []string{redaction.DetectorEmail}},
+	}
+	for _, c := range cases {
+		p, err := c.rc.Policy()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		var got []string
+		for _, r := range p.ValueRules {
+			got = append(got, r.Name)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s: value rules %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: value rules %v, want %v", c.name, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNormalizeRedactionConfigKeepsDefaultValueRules(t *testing.T) {
+	rc, err := NormalizeRedactionConfig(&RedactionConfig{DefaultValueRules: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rc.DefaultValueRules {
+		t.Error("defaultValueRules was dropped")
+	}
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Kinds of RecordingRoute.
+const (
+	RouteAll        = ""
+	RouteHeader     = "header"
+	RouteHost       = "host"
+	RoutePathPrefix = "path_prefix"
+)
+
+// SessionHeader selects the recording of a RouteHeader route.
+const SessionHeader = "X-Shigawire-Session-Id"
+
+// RecordingRoute decides which proxied requests a recording captures.
+//   - RouteAll (the default) takes every request no other route matched.
+//   - RouteHeader takes requests whose X-Shigawire-Session-Id header equals
+//     Value, which defaults to the session id.
+//   - RouteHost takes requests for the host in Value. Without a port it
+//     matches the host on any port.
+//   - RoutePathPrefix takes requests under the path in Value, which is
+//     removed from the path before the request is forwarded.
+type RecordingRoute struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value,omitempty"`
+}
+
+// Recording is a session that is currently recording.
+type Recording struct {
+	ProjectId string         `json:"project_id"`
+	SessionId string         `json:"session_id"`
+	Route     RecordingRoute `json:"route"`
+	StartedAt string         `json:"started_at"`
+}
+
+// NormalizeRecordingRoute validates a route and fills in its defaults.
+func NormalizeRecordingRoute(r RecordingRoute, sessionId string) (RecordingRoute, error) {
+	r.Kind = strings.TrimSpace(r.Kind)
+	r.Value = strings.TrimSpace(r.Value)
+	switch r.Kind {
+	case RouteAll:
+		r.Value = ""
+	case RouteHeader:
+		if r.Value == "" {
+			r.Value = sessionId
+		}
+	case RouteHost:
+		if r.Value == "" {
+			return RecordingRoute{}, fmt.Errorf("route: host is required")
+		}
+		r.Value = strings.ToLower(r.Value)
+	case RoutePathPrefix:
+		r.Value = "/" + strings.Trim(r.Value, "/")
+		if r.Value == "/" {
+			return RecordingRoute{}, fmt.Errorf("route: path prefix must not be empty")
+		}
+	default:
+		return RecordingRoute{}, fmt.Errorf("route: kind must be header, host or path_prefix")
+	}
+	return r, nil
+}
+
+// MatchesHeader reports whether a X-Shigawire-Session-Id value selects the route.
+func (r RecordingRoute) MatchesHeader(value string) bool {
+	return r.Kind == RouteHeader && value != "" && value == r.Value
+}
+
+// MatchesHost reports whether a request Host header selects the route.
+func (r RecordingRoute) MatchesHost(host string) bool {
+	if r.Kind != RouteHost {
+		return false
+	}
+	host = strings.ToLower(host)
+	if strings.Contains(r.Value, ":") {
+		return host == r.Value
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host == r.Value
+}
+
+// MatchesPath reports whether a request path is under the route's prefix.
+func (r RecordingRoute) MatchesPath(path string) bool {
+	return r.Kind == RoutePathPrefix && (path == r.Value || strings.HasPrefix(path, r.Value+"/"))
+}
+
+// StripPrefix removes the route's path prefix from a path it matches.
+func (r RecordingRoute) StripPrefix(path string) string {
+	rest := strings.TrimPrefix(path, r.Value)
+	if rest == "" {
+		return "/"
+	}
+	return rest
+}
@@ -0,0 +1,44 @@
+package models
+
+import "encoding/json"
+
+// Outcomes a replay run can end with.
+const (
+	ReplayOutcomeRunning     = "running"
+	ReplayOutcomePassed      = "passed"
+	ReplayOutcomeMismatched  = "mismatched"
+	ReplayOutcomeFailed      = "failed"
+	ReplayOutcomeStopped     = "stopped"
+	ReplayOutcomeInterrupted = "interrupted"
+)
+
+type ReplayRun struct {
+	Id          string          `json:"id"`
+	ProjectId   string          `json:"project_id"`
+	SessionId   string          `json:"session_id"`
+	Target      string          `json:"target"`
+	Speed       float64         `json:"speed"`
+	Outcome     string          `json:"outcome"`
+	StartedAt   string          `json:"started_at"`
+	EndedAt     string          `json:"ended_at,omitempty"`
+	TotalEvents int             `json:"total_events"`
+	Sent        int             `json:"sent"`
+	Failed      int             `json:"failed"`
+	Mismatched  int             `json:"mismatched"`
+	Results     []*ReplayResult `json:"results,omitempty"`
+}
+
+// ReplayResult is the outcome of re-issuing a single recorded event.
+type ReplayResult struct {
+	ReplayId       string          `json:"replay_id"`
+	Seq            int             `json:"seq"`
+	EventId        string          `json:"event_id"`
+	Method         string          `json:"method"`
+	URL            string          `json:"url"`
+	SentAt         string          `json:"sent_at"`
+	DurationMs     int64           `json:"duration_ms"`
+	RecordedStatus int             `json:"recorded_status"`
+	ReplayedStatus int             `json:"replayed_status"`
+	Error          string          `json:"error,omitempty"`
+	Diff           json.RawMessage `json:"diff,omitempty"`
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// UpstreamRoute is an entry of a project's routing table. Requests whose path
+// is under PathPrefix, or matches PathRegex, go to Upstream instead of the
+// project's own upstream. With StripPrefix the prefix, or the text the regex
+// matched at the start of the path, is removed before forwarding.
+type UpstreamRoute struct {
+	Name        string `json:"name"`
+	PathPrefix  string `json:"pathPrefix,omitempty"`
+	PathRegex   string `json:"pathRegex,omitempty"`
+	Upstream    string `json:"upstream"`
+	StripPrefix bool   `json:"stripPrefix,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// NormalizeUpstreamRoutes validates a routing table and compiles its patterns.
+// Routes without a name are named after their prefix or pattern.
+func NormalizeUpstreamRoutes(in []UpstreamRoute) ([]UpstreamRoute, error) {
+	out := make([]UpstreamRoute, 0, len(in))
+	seen := make(map[string]struct{}, len(in))
+	for i, r := range in {
+		r.Name = strings.TrimSpace(r.Name)
+		r.PathPrefix = strings.TrimSpace(r.PathPrefix)
+		r.Upstream = strings.TrimRight(strings.TrimSpace(r.Upstream), "/")
+
+		switch {
+		case r.PathPrefix != "" && r.PathRegex != "":
+			return nil, fmt.Errorf("config_json: routes[%d]: set pathPrefix or pathRegex, not both", i)
+		case r.PathPrefix != "":
+			r.PathPrefix = "/" + strings.Trim(r.PathPrefix, "/")
+			if r.PathPrefix == "/" {
+				return nil, fmt.Errorf("config_json: routes[%d]: pathPrefix must not be empty", i)
+			}
+		case r.PathRegex != "":
+			re, err := regexp.Compile(r.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("config_json: routes[%d]: invalid pathRegex: %w", i, err)
+			}
+			r.re = re
+		default:
+			return nil, fmt.Errorf("config_json: routes[%d]: pathPrefix or pathRegex is required", i)
+		}
+
+		u, err := url.Parse(r.Upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("config_json: routes[%d]: upstream must be an absolute http or https URL", i)
+		}
+
+		if r.Name == "" {
+			r.Name = firstNonEmpty(r.PathPrefix, r.PathRegex)
+		}
+		if _, dup := seen[r.Name]; dup {
+			return nil, fmt.Errorf("config_json: routes[%d]: duplicate name %q", i, r.Name)
+		}
+		seen[r.Name] = struct{}{}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Match reports whether the route takes a request for path, and the leading
+// part of path to remove before forwarding it.
+func (r UpstreamRoute) Match(path string) (strip string, ok bool) {
+	if r.re != nil {
+		loc := r.re.FindStringIndex(path)
+		if loc == nil {
+			return "", false
+		}
+		if r.StripPrefix && loc[0] == 0 {
+			return path[:loc[1]], true
+		}
+		return "", true
+	}
+	if path != r.PathPrefix && !strings.HasPrefix(path, r.PathPrefix+"/") {
+		return "", false
+	}
+	if r.StripPrefix {
+		return r.PathPrefix, true
+	}
+	return "", true
+}
+
+// MatchUpstreamRoute returns the first route of a table that takes path.
+func MatchUpstreamRoute(routes []UpstreamRoute, path string) (route UpstreamRoute, strip string, ok bool) {
+	for _, r := range routes {
+		if strip, ok := r.Match(path); ok {
+			return r, strip, true
+		}
+	}
+	return UpstreamRoute{}, "", false
+}
+
+// Upstream returns the upstream base URL a request for path is sent to, the
+// name of the route that chose it, empty for the project's own upstream, and
+// the leading part of path to remove.
+func (c ProjectConfig) Upstream(path string) (base, route, strip string) {
+	if r, strip, ok := MatchUpstreamRoute(c.Routes, path); ok {
+		return r.Upstream, r.Name, strip
+	}
+	return c.UpstreamBaseUrl(), "", ""
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeUpstreamRoutes(t *testing.T) {
+	routes, err := NormalizeUpstreamRoutes([]UpstreamRoute{
+		{PathPrefix: " billing/ ", Upstream: "http://billing:8080/ "},
+		{Name: "v2", PathRegex: `^/api/v\d+`, Upstream: "https://api.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := routes[0]; r.Name != "/billing" || r.PathPrefix != "/billing" || r.Upstream != "http://billing:8080" {
+		t.Errorf("prefix route normalized to %+v", r)
+	}
+	if r := routes[1]; r.Name != "v2" || r.re == nil {
+		t.Errorf("regex route normalized to %+v", r)
+	}
+
+	invalid := map[string][]UpstreamRoute{
+		"both":         {{PathPrefix: "/a", PathRegex: "^/a", Upstream: "http://a"}},
+		"neither":      {{Upstream: "http://a"}},
+		"empty prefix": {{PathPrefix: "/", Upstream: "http://a"}},
+		"bad regex":    {{PathRegex: "(", Upstream: "http://a"}},
+		"relative":     {{PathPrefix: "/a", Upstream: "/a"}},
+		"scheme":       {{PathPrefix: "/a", Upstream: "ftp://a"}},
+		"duplicate":    {{PathPrefix: "/a", Upstream: "http://a"}, {Name: "/a", PathPrefix: "/b", Upstream: "http://b"}},
+		"missing host": {{PathPrefix: "/a", Upstream: "http://"}},
+		"no upstream":  {{PathPrefix: "/a"}},
+	}
+	for name, in := range invalid {
+		if _, err := NormalizeUpstreamRoutes(in); err == nil || !strings.HasPrefix(err.Error(), "config_json: routes[") {
+			t.Errorf("%s: err = %v, want a routes error", name, err)
+		}
+	}
+}
+
+func TestProjectConfigUpstream(t *testing.T) {
+	normalized, _, err := NormalizeProjectConfig(`{
+		"targetHost": "app", "targetPort": 3000,
+		"routes": [
+			{"name": "billing", "pathPrefix": "/billing", "upstream": "http://billing:8080", "stripPrefix": true},
+			{"name": "billing-admin", "pathPrefix": "/billing/admin", "upstream": "http://admin:8080"},
+			{"name": "versioned", "pathRegex": "^/api/v[0-9]+", "upstream": "https://api.example.com/base", "stripPrefix": true},
+			{"name": "anywhere", "pathRegex": "/export$", "upstream": "http://export:8080", "stripPrefix": true}
+		]
+	}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseProjectConfig(normalized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path, base, route, strip string
+	}{
+		{"/users", "http://app:3000", "", ""},
+		{"/billing", "http://billing:8080", "billing", "/billing"},
+		{"/billing/invoices", "http://billing:8080", "billing", "/billing"},
+		// A prefix only matches whole path segments.
+		{"/billingx", "http://app:3000", "", ""},
+		// The first matching route wins, even if a later one is longer.
+		{"/billing/admin/x", "http://billing:8080", "billing", "/billing"},
+		{"/api/v12/users", "https://api.example.com/base", "versioned", "/api/v12"},
+		{"/api/vx/users", "http://app:3000", "", ""},
+		// A regex matching later in the path strips nothing.
+		{"/reports/export", "http://export:8080", "anywhere", ""},
+	}
+	for _, c := range cases {
+		base, route, strip := cfg.Upstream(c.path)
+		if base != c.base || route != c.route || strip != c.strip {
+			t.Errorf("Upstream(%q) = %q, %q, %q; want %q, %q, %q", c.path, base, route, strip, c.base, c.route, c.strip)
+		}
+	}
+}
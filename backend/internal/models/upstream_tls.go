@@ -0,0 +1,90 @@
+package models
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// UpstreamTLSConfig is the "tls" section of a project's config_json: how the
+// proxy connects to the project's https upstreams.
+type UpstreamTLSConfig struct {
+	// CAPem holds PEM certificates trusted in addition to the system roots.
+	CAPem string `json:"caPem,omitempty"`
+	// ClientCertPem and ClientKeyPem are presented to upstreams that ask for
+	// a client certificate. The key is only accepted on input: it is stored
+	// apart from the config, which keeps HasClientKey instead.
+	ClientCertPem string `json:"clientCertPem,omitempty"`
+	ClientKeyPem  string `json:"clientKeyPem,omitempty"`
+	HasClientKey  bool   `json:"hasClientKey,omitempty"`
+	// ServerName replaces the upstream host as the SNI name and the name the
+	// certificate is checked against.
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// NormalizeUpstreamTLSConfig trims the section and checks that its
+// certificates and key can be loaded. A section with hasClientKey and no
+// clientKeyPem keeps storedKey. The client key is returned apart, and the
+// section keeps only HasClientKey. An empty section is dropped.
+func NormalizeUpstreamTLSConfig(in *UpstreamTLSConfig, storedKey string) (*UpstreamTLSConfig, string, error) {
+	if in == nil {
+		return nil, "", nil
+	}
+	key := strings.TrimSpace(in.ClientKeyPem)
+	if key == "" && in.HasClientKey {
+		if storedKey == "" {
+			return nil, "", fmt.Errorf("config_json: tls.hasClientKey is set but no client key is stored")
+		}
+		key = storedKey
+	}
+	out := &UpstreamTLSConfig{
+		CAPem:              strings.TrimSpace(in.CAPem),
+		ClientCertPem:      strings.TrimSpace(in.ClientCertPem),
+		ClientKeyPem:       key,
+		ServerName:         strings.TrimSpace(in.ServerName),
+		InsecureSkipVerify: in.InsecureSkipVerify,
+	}
+	if *out == (UpstreamTLSConfig{}) {
+		return nil, "", nil
+	}
+	if _, err := out.ClientConfig(); err != nil {
+		return nil, "", err
+	}
+	out.ClientKeyPem = ""
+	out.HasClientKey = key != ""
+	return out, key, nil
+}
+
+// ClientConfig returns the TLS settings for connections to the upstream.
+func (c *UpstreamTLSConfig) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAPem != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(c.CAPem)) {
+			return nil, fmt.Errorf("config_json: tls.caPem: no PEM certificates found")
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.ClientCertPem != "" || c.ClientKeyPem != "" {
+		if c.ClientCertPem == "" || c.ClientKeyPem == "" {
+			return nil, fmt.Errorf("config_json: tls.clientCertPem and tls.clientKeyPem must be set together")
+		}
+		cert, err := tls.X509KeyPair([]byte(c.ClientCertPem), []byte(c.ClientKeyPem))
+		if err != nil {
+			return nil, fmt.Errorf("config_json: tls client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import "fmt"
+
+// TransportConfig is the "transport" section of a project's config_json:
+// timeouts and connection pooling for its upstreams. Durations are in
+// milliseconds, and fields left at zero keep the defaults.
+type TransportConfig struct {
+	DialTimeoutMs           int `json:"dialTimeoutMs,omitempty"`
+	TLSHandshakeTimeoutMs   int `json:"tlsHandshakeTimeoutMs,omitempty"`
+	ResponseHeaderTimeoutMs int `json:"responseHeaderTimeoutMs,omitempty"`
+	// TimeoutMs bounds a whole exchange, reading the response body included.
+	// There is none by default, so downloads and event streams can run as
+	// long as they need.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+	// MaxIdleConns is how many idle connections are kept for each upstream
+	// host.
+	MaxIdleConns int `json:"maxIdleConns,omitempty"`
+	// HTTP2 is attempted unless set to false.
+	HTTP2 *bool `json:"http2,omitempty"`
+}
+
+// NormalizeTransportConfig rejects negative values. An empty section is
+// dropped.
+func NormalizeTransportConfig(in *TransportConfig) (*TransportConfig, error) {
+	if in == nil {
+		return nil, nil
+	}
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"dialTimeoutMs", in.DialTimeoutMs},
+		{"tlsHandshakeTimeoutMs", in.TLSHandshakeTimeoutMs},
+		{"responseHeaderTimeoutMs", in.ResponseHeaderTimeoutMs},
+		{"timeoutMs", in.TimeoutMs},
+		{"maxIdleConns", in.MaxIdleConns},
+	} {
+		if f.value < 0 {
+			return nil, fmt.Errorf("config_json: transport.%s must not be negative", f.name)
+		}
+	}
+	if *in == (TransportConfig{}) {
+		return nil, nil
+	}
+	out := *in
+	return &out, nil
+}
@@ -0,0 +1,10 @@
+package models
+
+// VaultEntry is the encrypted original of a value redacted from an event.
+// Entries are internal to the backend and never serialized to API clients.
+type VaultEntry struct {
+	EventId     string
+	SessionId   string
+	Placeholder string
+	Ciphertext  []byte
+}
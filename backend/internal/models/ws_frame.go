@@ -0,0 +1,31 @@
+package models
+
+// WebSocket opcodes as defined by RFC 6455.
+const (
+	WSOpcodeText   = 1
+	WSOpcodeBinary = 2
+	WSOpcodeClose  = 8
+	WSOpcodePing   = 9
+	WSOpcodePong   = 10
+)
+
+// Directions a captured WebSocket frame can travel in.
+const (
+	WSDirectionClient = "client" // client -> upstream
+	WSDirectionServer = "server" // upstream -> client
+)
+
+// WSFrame is a single message captured on a proxied WebSocket connection.
+// Frames are children of the connection's Event.
+type WSFrame struct {
+	Id               string `json:"id"`
+	EventId          string `json:"event_id"`
+	Seq              int    `json:"seq"`
+	Direction        string `json:"direction"`
+	Opcode           int    `json:"opcode"`
+	Timestamp        string `json:"timestamp"`
+	Payload          string `json:"payload,omitempty"`
+	PayloadEncoding  string `json:"payload_encoding,omitempty"` // text|base64|empty
+	Size             int    `json:"size"`
+	RedactionApplied string `json:"redaction_applied,omitempty"`
+}
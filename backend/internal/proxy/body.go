@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"errors"
+
+	"github.com/shigawire-dev/internal/contentcoding"
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+// capturedBody is a request or response body as it is stored on an event.
+type capturedBody struct {
+	content         string
+	encoding        string
+	size            int
+	sha256          string
+	truncated       bool
+	contentEncoding string
+	applied         []string
+}
+
+// captureBody redacts a captured body for storage. Size and SHA-256 describe
+// the whole (decoded) body, whether it is stored in full or truncated, so a
+// replay can tell whether it changed. Text is cut at the limit again in case
+// redaction made it longer.
+func captureBody(contentType string, b *bodyCapture, direction string, policy redaction.Policy) capturedBody {
+	if b == nil {
+		return capturedBody{}
+	}
+	err := b.finish()
+	tooLarge := errors.Is(err, contentcoding.ErrTooLarge)
+	if err != nil && !tooLarge {
+		// Still compressed, the body can't be redacted, so it isn't stored.
+		return capturedBody{applied: []string{direction + "_body_decode_failed"}}
+	}
+	if b.wireSize == 0 {
+		return capturedBody{}
+	}
+
+	c := capturedBody{
+		size:            int(b.buf.size),
+		sha256:          b.buf.SHA256(),
+		truncated:       b.buf.Truncated(),
+		contentEncoding: b.contentEncoding,
+	}
+	if tooLarge {
+		// Decoding stopped early: the prefix is kept, but the decoded size
+		// and hash of the whole body are unknown, so the size is the one on
+		// the wire.
+		c.size, c.sha256, c.truncated = int(b.wireSize), "", true
+	}
+	if c.truncated {
+		c.content, c.encoding, c.applied = redaction.SanitizeTruncatedBody(contentType, b.buf.Bytes(), direction, policy)
+	} else {
+		c.content, c.encoding, c.applied = redaction.SanitizeBody(contentType, b.buf.Bytes(), direction, policy)
+	}
+	if c.encoding == redaction.BodyEncodingText && len(c.content) > b.buf.limit {
+		c.content = truncateString(c.content, b.buf.limit)
+		c.truncated = true
+	}
+	if tooLarge {
+		c.applied = append(c.applied, direction+"_body_decode_limit")
+	}
+	return c
+}
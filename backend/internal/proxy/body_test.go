@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shigawire-dev/internal/contentcoding"
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+func TestCaptureBodyDecodeLimit(t *testing.T) {
+	// A body that decodes to more than maxDecodedBodyBytes keeps the prefix
+	// decoded so far.
+	b := &bodyCapture{buf: newCaptureBuffer(8), wireSize: 1000, contentEncoding: "gzip", decErr: contentcoding.ErrTooLarge}
+	b.buf.Write([]byte("line one\nline two"))
+
+	got := captureBody("text/plain", b, "resp", redaction.Policy{})
+	want := capturedBody{
+		content:         "line ",
+		encoding:        redaction.BodyEncodingText,
+		size:            1000,
+		truncated:       true,
+		contentEncoding: "gzip",
+		applied:         []string{"resp_body_decode_limit"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("captureBody = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/shigawire-dev/internal/contentcoding"
+)
+
+// Decoding a captured body stops after this many bytes, so a small compressed
+// body can't keep the proxy busy without bound.
+const maxDecodedBodyBytes = 1 << 30
+
+// captureBuffer is the tee target for a streamed body. It keeps at most limit
+// bytes for storage and discards the rest, so memory stays bounded no matter
+// how large the body is; size and hash still cover the whole body.
+type captureBuffer struct {
+	limit int
+	buf   bytes.Buffer
+	size  int64
+	hash  hash.Hash
+}
+
+func newCaptureBuffer(limit int) *captureBuffer {
+	return &captureBuffer{limit: limit, hash: sha256.New()}
+}
+
+func (c *captureBuffer) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	c.hash.Write(p)
+	if room := c.limit - c.buf.Len(); room > 0 {
+		if len(p) > room {
+			c.buf.Write(p[:room])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (c *captureBuffer) Bytes() []byte {
+	return c.buf.Bytes()
+}
+
+// Truncated reports whether part of the body was discarded.
+func (c *captureBuffer) Truncated() bool {
+	return c.size > int64(c.buf.Len())
+}
+
+// SHA256 is the hex digest of the whole body.
+func (c *captureBuffer) SHA256() string {
+	return hex.EncodeToString(c.hash.Sum(nil))
+}
+
+// bodyCapture records a body as it streams through the proxy. A body sent
+// with a Content-Encoding is decoded on the way, in its own goroutine, so the
+// stored prefix, size and hash all describe the decoded content while the
+// client and upstream still exchange the encoded bytes.
+type bodyCapture struct {
+	buf             *captureBuffer
+	wireSize        int64
+	contentEncoding string
+
+	pw     *io.PipeWriter
+	done   chan struct{}
+	once   sync.Once
+	decErr error
+}
+
+func newBodyCapture(limit int, contentEncoding string) *bodyCapture {
+	c := &bodyCapture{buf: newCaptureBuffer(limit)}
+	codings := contentcoding.Codings(contentEncoding)
+	if len(codings) == 0 {
+		return c
+	}
+	c.contentEncoding = strings.Join(codings, ", ")
+
+	pr, pw := io.Pipe()
+	c.pw, c.done = pw, make(chan struct{})
+	go func() {
+		defer close(c.done)
+		c.decErr = c.decode(pr, contentEncoding)
+		// Keep reading so the proxied stream never waits on a failed decode.
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	return c
+}
+
+func (c *bodyCapture) decode(r io.Reader, contentEncoding string) error {
+	d, err := contentcoding.NewReader(r, contentEncoding)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	n, err := io.Copy(c.buf, io.LimitReader(d, maxDecodedBodyBytes+1))
+	if err != nil {
+		return err
+	}
+	if n > maxDecodedBodyBytes {
+		return contentcoding.ErrTooLarge
+	}
+	return nil
+}
+
+// Write never fails, so that capturing can't break the exchange it records.
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.wireSize += int64(len(p))
+	if c.pw == nil {
+		return c.buf.Write(p)
+	}
+	_, _ = c.pw.Write(p)
+	return len(p), nil
+}
+
+// finish marks the end of the body and waits for decoding to catch up. It
+// returns the decode error, if any.
+func (c *bodyCapture) finish() error {
+	c.once.Do(func() {
+		if c.pw != nil {
+			_ = c.pw.Close()
+			<-c.done
+		}
+	})
+	return c.decErr
+}
+
+// copyResponse streams src to the client. Responses without a known length
+// (chunked downloads, long-polling) and server-sent events are flushed after
+// every read so the client sees data as soon as the upstream sends it.
+func copyResponse(w http.ResponseWriter, src io.Reader, resp *http.Response) error {
+	flusher, _ := w.(http.Flusher)
+	flushEach := flusher != nil && (resp.ContentLength == -1 || isEventStream(resp.Header.Get("Content-Type")))
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			if flushEach {
+				flusher.Flush()
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
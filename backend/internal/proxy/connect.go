@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type interceptedHostKey struct{}
+
+// handleConnect terminates TLS for a CONNECT tunnel using a certificate minted
+// by the Shigawire CA, then serves the decrypted requests through handleProxy.
+func (l *Listener) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if l.CA == nil {
+		http.Error(w, "https interception is not available", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be hijacked", http.StatusInternalServerError)
+		return
+	}
+
+	targetHost := r.Host
+	hostname, _, err := net.SplitHostPort(targetHost)
+	if err != nil {
+		hostname = targetHost
+		targetHost = net.JoinHostPort(targetHost, "443")
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		log.Printf("proxy: hijack CONNECT %s: %v", targetHost, err)
+		return
+	}
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	tlsConn := tls.Server(&bufferedConn{Conn: conn, r: rw.Reader}, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = hostname
+			}
+			return l.CA.CertificateFor(name)
+		},
+	})
+
+	handshakeCtx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+		log.Printf("proxy: tls handshake for %s: %v", targetHost, err)
+		_ = tlsConn.Close()
+		return
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), interceptedHostKey{}, targetHost))
+			l.handleProxy(w, req)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       90 * time.Second,
+	}
+	if !l.trackTunnel(srv) {
+		_ = tlsConn.Close()
+		return
+	}
+	defer l.untrackTunnel(srv)
+	ln := newSingleConnListener(tlsConn)
+	_ = srv.Serve(ln)
+	// Serve returns without accepting if the listener shut down first.
+	if c := ln.take(); c != nil {
+		_ = c.Close()
+	}
+}
+
+// trackTunnel registers the server of a tunnel, unless the listener is
+// shutting down.
+func (l *Listener) trackTunnel(srv *http.Server) bool {
+	l.tunnelsMu.Lock()
+	defer l.tunnelsMu.Unlock()
+	if l.closing {
+		return false
+	}
+	if l.tunnels == nil {
+		l.tunnels = make(map[*http.Server]struct{})
+	}
+	l.tunnels[srv] = struct{}{}
+	return true
+}
+
+func (l *Listener) untrackTunnel(srv *http.Server) {
+	l.tunnelsMu.Lock()
+	delete(l.tunnels, srv)
+	l.tunnelsMu.Unlock()
+}
+
+// shutdownTunnels shuts down the servers of open tunnels, and closes those
+// still busy when ctx is done.
+func (l *Listener) shutdownTunnels(ctx context.Context) {
+	l.tunnelsMu.Lock()
+	l.closing = true
+	servers := make([]*http.Server, 0, len(l.tunnels))
+	for srv := range l.tunnels {
+		servers = append(servers, srv)
+	}
+	l.tunnelsMu.Unlock()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			_ = srv.Close()
+		}
+	}
+}
+
+// interceptedHost returns the CONNECT target for requests decrypted from a tunnel.
+func interceptedHost(ctx context.Context) (string, bool) {
+	host, ok := ctx.Value(interceptedHostKey{}).(string)
+	return host, ok
+}
+
+// bufferedConn drains bytes the client sent right after CONNECT that were
+// already read into the server's buffer before the connection was hijacked.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	if c.r != nil && c.r.Buffered() > 0 {
+		return c.r.Read(p)
+	}
+	return c.Conn.Read(p)
+}
+
+// singleConnListener hands one connection to http.Server.Serve and reports
+// closed once that connection is done, or the listener is closed by a
+// shutdown, so Serve returns.
+type singleConnListener struct {
+	conn      net.Conn
+	once      sync.Once
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	l := &singleConnListener{closed: make(chan struct{})}
+	l.conn = &notifyCloseConn{Conn: conn, onClose: l.markClosed}
+	return l
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	if c := l.take(); c != nil {
+		return c, nil
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *singleConnListener) take() net.Conn {
+	var c net.Conn
+	l.once.Do(func() { c = l.conn })
+	return c
+}
+
+func (l *singleConnListener) markClosed() {
+	l.closeOnce.Do(func() { close(l.closed) })
+}
+
+func (l *singleConnListener) Close() error {
+	l.markClosed()
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+type notifyCloseConn struct {
+	net.Conn
+	closeOnce sync.Once
+	onClose   func()
+}
+
+func (c *notifyCloseConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.onClose)
+	return err
+}
@@ -1,7 +1,6 @@
 package proxy
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -10,35 +9,56 @@ import (
 	"io"
 	"log"
 	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shigawire-dev/internal/certs"
 	"github.com/shigawire-dev/internal/control"
 	"github.com/shigawire-dev/internal/models"
 	"github.com/shigawire-dev/internal/redaction"
 	"github.com/shigawire-dev/internal/store"
-)
-
-const (
-	maxCapturedBodyBytes = 64 * 1024
+	"github.com/shigawire-dev/internal/upstream"
+	"github.com/shigawire-dev/internal/vault"
 )
 
 type Listener struct {
-	Addr            string
+	Addr string
+	// ProjectID is set on a project's own listener. Its traffic goes to that
+	// project's upstream, and only that project's recordings capture it.
+	ProjectID       string
 	DB              *sql.DB
 	Rec             *control.RecordingState
+	PB              *control.PlaybackState
 	EB              *control.EventBus
+	CA              *certs.CA
+	Vault           *vault.Vault
 	DefaultUpstream string
-	server          *http.Server
+	// Upstreams holds the clients for project upstreams; it is shared by all
+	// listeners.
+	Upstreams *upstream.Pool
+	server    *http.Server
+
+	// tunnels are the servers of intercepted CONNECT tunnels, which outlive
+	// the hijacked connection they came in on; they are shut down with the
+	// listener.
+	tunnelsMu sync.Mutex
+	tunnels   map[*http.Server]struct{}
+	closing   bool
+
+	playbackMu sync.Mutex
+	playbacks  map[string]*playbackIndex
 }
 
 type healthResponse struct {
-	Ok   bool   `json:"ok"`
-	Addr string `json:"addr"`
+	Ok        bool   `json:"ok"`
+	Addr      string `json:"addr"`
+	ProjectId string `json:"project_id,omitempty"`
 }
 
 type upstreamCheckResponse struct {
@@ -49,7 +69,7 @@ type upstreamCheckResponse struct {
 	Error      string `json:"error,omitempty"`
 }
 
-func NewListenerFromEnv(db *sql.DB, rec *control.RecordingState, eb *control.EventBus) *Listener {
+func NewListenerFromEnv(db *sql.DB, rec *control.RecordingState, pb *control.PlaybackState, eb *control.EventBus, ca *certs.CA, v *vault.Vault) *Listener {
 	proxyPort := os.Getenv("PROXY_PORT")
 	if proxyPort == "" {
 		proxyPort = "9090"
@@ -59,20 +79,47 @@ func NewListenerFromEnv(db *sql.DB, rec *control.RecordingState, eb *control.Eve
 		Addr:            ":" + proxyPort,
 		DB:              db,
 		Rec:             rec,
+		PB:              pb,
 		EB:              eb,
+		CA:              ca,
+		Vault:           v,
 		DefaultUpstream: strings.TrimSpace(os.Getenv("DEFAULT_UPSTREAM_BASE_URL")),
+		Upstreams: upstream.NewPool(func(projectId string) (string, error) {
+			return v.ClientKey(db, projectId)
+		}),
 	}
 }
 
 func (l *Listener) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.Addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(ctx, ln)
+}
+
+// Serve handles proxy traffic on ln until ctx is done.
+func (l *Listener) Serve(ctx context.Context, ln net.Listener) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", l.handleHealth)
 	mux.HandleFunc("/upstream-check", l.handleUpstreamCheck)
 	mux.HandleFunc("/", l.handleProxy)
 
 	l.server = &http.Server{
-		Addr:              l.Addr,
-		Handler:           mux,
+		Addr: l.Addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodConnect {
+				l.handleConnect(w, r)
+				return
+			}
+			// Absolute-form targets come from clients using us as a forward
+			// proxy and must never hit the listener's own endpoints.
+			if r.URL.IsAbs() {
+				l.handleProxy(w, r)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		}),
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
@@ -81,9 +128,10 @@ func (l *Listener) Start(ctx context.Context) error {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		_ = l.server.Shutdown(shutdownCtx)
+		l.shutdownTunnels(shutdownCtx)
 	}()
 
-	err := l.server.ListenAndServe()
+	err := l.server.Serve(ln)
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -91,11 +139,12 @@ func (l *Listener) Start(ctx context.Context) error {
 }
 
 func (l *Listener) handleHealth(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, healthResponse{Ok: true, Addr: l.Addr})
+	writeJSON(w, http.StatusOK, healthResponse{Ok: true, Addr: l.Addr, ProjectId: l.ProjectID})
 }
 
 func (l *Listener) handleUpstreamCheck(w http.ResponseWriter, r *http.Request) {
-	projectID, _, upstreamBase, _, err := l.resolveUpstream(r)
+	t, err := l.resolveUpstream(r)
+	projectID, upstreamBase := t.projectID, t.base
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, upstreamCheckResponse{
 			Ok:        false,
@@ -105,7 +154,18 @@ func (l *Listener) handleUpstreamCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
+	upstreamClient, err := l.upstreamClient(t)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, upstreamCheckResponse{
+			Ok:        false,
+			ProjectId: projectID,
+			TargetURL: upstreamBase,
+			Error:     err.Error(),
+		})
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second, Transport: upstreamClient.Transport}
 	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, upstreamBase, nil)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, upstreamCheckResponse{
@@ -138,29 +198,69 @@ func (l *Listener) handleUpstreamCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 func (l *Listener) handleProxy(w http.ResponseWriter, r *http.Request) {
-	projectID, sessionID, upstreamBase, shouldRecord, err := l.resolveUpstream(r)
+	if p, ok := l.playbackFor(r); ok {
+		l.servePlayback(w, r, p)
+		return
+	}
+
+	t, err := l.resolveUpstream(r)
+	if base, ok := forwardTarget(r); ok {
+		// The client picked the upstream itself; recording state only decides
+		// whether the exchange is captured.
+		t.base, t.route, t.strip, t.cfg, err = base, "", "", nil, nil
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	targetURL, err := buildUpstreamURL(upstreamBase, r.URL)
+	targetURL, err := buildUpstreamURL(t.base, r.URL, t.strip)
 	if err != nil {
 		http.Error(w, "invalid upstream url", http.StatusInternalServerError)
 		return
 	}
 
-	reqBody, err := io.ReadAll(r.Body)
+	client, err := l.upstreamClient(t)
 	if err != nil {
-		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	upReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, bytes.NewReader(reqBody))
+	if isWebSocketUpgrade(r) {
+		transport, ok := client.Transport.(*http.Transport)
+		if !ok {
+			http.Error(w, "upstream transport does not support websockets", http.StatusBadGateway)
+			return
+		}
+		l.proxyWebSocket(w, r, targetURL, t, transport)
+		return
+	}
+
+	// Bodies stream straight through; the captures only keep what can be
+	// stored, plus the size and hash of the rest.
+	var reqCapture, respCapture *bodyCapture
+	limit := 0
+	if t.record {
+		limit = l.captureLimit(t.projectID)
+		reqCapture = newBodyCapture(limit, r.Header.Get("Content-Encoding"))
+		defer reqCapture.finish()
+	}
+	var reqBody io.Reader = http.NoBody
+	var reqSent <-chan struct{}
+	if r.ContentLength != 0 {
+		reqBody = r.Body
+		if reqCapture != nil {
+			b := newSentBody(io.TeeReader(r.Body, reqCapture))
+			reqBody, reqSent = b, b.closed
+		}
+	}
+
+	upReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, reqBody)
 	if err != nil {
 		http.Error(w, "failed to create upstream request", http.StatusInternalServerError)
 		return
 	}
+	upReq.ContentLength = r.ContentLength
 
 	copyHeaders(upReq.Header, r.Header)
 	removeHopByHopHeaders(upReq.Header)
@@ -172,112 +272,240 @@ func (l *Listener) handleProxy(w http.ResponseWriter, r *http.Request) {
 
 	startedAt := time.Now().UTC()
 
-	client := &http.Client{Timeout: 30 * time.Second}
 	upResp, err := client.Do(upReq)
 	if err != nil {
-		if shouldRecord {
-			l.persistEvent(sessionID, startedAt, time.Now().UTC(), r, reqBody, 502, nil, nil, "upstream_error:"+err.Error())
+		if t.record {
+			waitSent(reqSent)
+			l.persistEvent(t, startedAt, time.Now().UTC(), r, reqCapture, 502, nil, nil, "upstream_error:"+err.Error())
 		}
 		http.Error(w, "upstream unavailable", http.StatusBadGateway)
 		return
 	}
 	defer upResp.Body.Close()
 
-	respBody, err := io.ReadAll(upResp.Body)
-	if err != nil {
-		http.Error(w, "failed to read upstream response", http.StatusBadGateway)
-		return
-	}
-
 	copyHeaders(w.Header(), upResp.Header)
 	removeHopByHopHeaders(w.Header())
 	w.WriteHeader(upResp.StatusCode)
-	_, _ = w.Write(respBody)
 
-	if shouldRecord {
-		l.persistEvent(sessionID, startedAt, time.Now().UTC(), r, reqBody, upResp.StatusCode, upResp.Header, respBody, "")
+	var respBody io.Reader = upResp.Body
+	if t.record {
+		respCapture = newBodyCapture(limit, upResp.Header.Get("Content-Encoding"))
+		defer respCapture.finish()
+		respBody = io.TeeReader(upResp.Body, respCapture)
+	}
+	streamNote := ""
+	if err := copyResponse(w, respBody, upResp); err != nil {
+		streamNote = "stream_interrupted:" + err.Error()
+	}
+
+	if t.record {
+		// An upstream may answer before it has read the whole request; the
+		// transport keeps sending the body until the exchange is over.
+		upResp.Body.Close()
+		waitSent(reqSent)
+		l.persistEvent(t, startedAt, time.Now().UTC(), r, reqCapture, upResp.StatusCode, upResp.Header, respCapture, streamNote)
+	}
+}
+
+// sentBody is a request body whose closed channel is closed once the
+// transport is done with it, so what it read can be stored safely.
+type sentBody struct {
+	io.Reader
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newSentBody(r io.Reader) *sentBody {
+	return &sentBody{Reader: r, closed: make(chan struct{})}
+}
+
+func (b *sentBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+// waitSent waits for the transport to close a sentBody, if there is one.
+func waitSent(closed <-chan struct{}) {
+	if closed != nil {
+		<-closed
 	}
+}
 
-	_ = projectID
+// upstreamTarget is where resolveUpstream sends a request.
+type upstreamTarget struct {
+	projectID string
+	sessionID string
+	record    bool
+
+	base string
+	// route names the entry of the project's routing table that chose base,
+	// and strip is the leading part of the path it removes.
+	route string
+	strip string
+	// cfg is the config of the project whose upstream base is; nil when
+	// base isn't a project upstream.
+	cfg *models.ProjectConfig
 }
 
-func (l *Listener) resolveUpstream(r *http.Request) (projectID, sessionID, upstreamBase string, shouldRecord bool, err error) {
-	active, recProjectID, recSessionID := l.Rec.Get()
-	if active {
-		cfg, cfgErr := l.loadProjectConfig(recProjectID)
+// resolveUpstream picks the recording that captures r, if any, and the
+// upstream to forward it to, following the project's routing table. The
+// session routing header is removed from r, and so is the prefix of a
+// path-prefix recording route, so the upstream sees the path it would have
+// been sent without the proxy.
+func (l *Listener) resolveUpstream(r *http.Request) (upstreamTarget, error) {
+	var rec models.Recording
+	var recording bool
+	if l.ProjectID != "" {
+		rec, recording = l.Rec.MatchProject(r, l.ProjectID)
+	} else {
+		rec, recording = l.Rec.Match(r)
+	}
+	r.Header.Del(models.SessionHeader)
+	if recording {
+		cfg, cfgErr := l.loadProjectConfig(rec.ProjectId)
+		if cfgErr != nil {
+			_ = l.Rec.Stop(rec.SessionId)
+			return upstreamTarget{}, fmt.Errorf("invalid recording state was reset: %w", cfgErr)
+		}
+		if rec.Route.Kind == models.RoutePathPrefix {
+			r.URL.Path = rec.Route.StripPrefix(r.URL.Path)
+			r.URL.RawPath = ""
+		}
+		t := projectTarget(rec.ProjectId, cfg, r.URL.Path)
+		t.sessionID, t.record = rec.SessionId, true
+		return t, nil
+	}
+
+	if l.ProjectID != "" {
+		cfg, cfgErr := l.loadProjectConfig(l.ProjectID)
 		if cfgErr != nil {
-			l.Rec.Stop()
-			return "", "", "", false, fmt.Errorf("invalid recording state was reset: %w", cfgErr)
+			return upstreamTarget{projectID: l.ProjectID}, cfgErr
 		}
-		return recProjectID, recSessionID, cfg.UpstreamBaseUrl(), true, nil
+		return projectTarget(l.ProjectID, cfg, r.URL.Path), nil
 	}
 
 	if l.DefaultUpstream != "" {
-		return "", "", l.DefaultUpstream, false, nil
+		return upstreamTarget{base: l.DefaultUpstream}, nil
 	}
 
 	headerProjectID := strings.TrimSpace(r.Header.Get("X-Shigawire-Project-Id"))
 	if headerProjectID != "" {
 		cfg, cfgErr := l.loadProjectConfig(headerProjectID)
 		if cfgErr != nil {
-			return "", "", "", false, cfgErr
+			return upstreamTarget{}, cfgErr
 		}
-		return headerProjectID, "", cfg.UpstreamBaseUrl(), false, nil
+		return projectTarget(headerProjectID, cfg, r.URL.Path), nil
 	}
 
-	return "", "", "", false, errors.New("no upstream configured; set DEFAULT_UPSTREAM_BASE_URL or start recording for a session")
+	return upstreamTarget{}, errors.New("no upstream configured; set DEFAULT_UPSTREAM_BASE_URL or start recording for a session")
+}
+
+// projectTarget sends a request for path to the project's upstream for it.
+func projectTarget(projectID string, cfg *models.ProjectConfig, path string) upstreamTarget {
+	base, route, strip := cfg.Upstream(path)
+	return upstreamTarget{projectID: projectID, base: base, route: route, strip: strip, cfg: cfg}
+}
+
+// defaultClient reaches upstreams that aren't a project's.
+var defaultClient = &http.Client{Transport: upstream.Default}
+
+// upstreamClient returns the client for t's upstream, with the project's TLS,
+// timeout and pooling settings when it is a project upstream.
+func (l *Listener) upstreamClient(t upstreamTarget) (*http.Client, error) {
+	if t.cfg == nil {
+		return defaultClient, nil
+	}
+	return l.Upstreams.Client(t.projectID, t.cfg)
 }
 
 func (l *Listener) loadProjectConfig(projectID string) (*models.ProjectConfig, error) {
-	p, err := store.GetProject(l.DB, projectID)
-	if err != nil {
-		return nil, fmt.Errorf("load project: %w", err)
+	return store.GetProjectConfig(l.DB, projectID)
+}
+
+// captureLimit returns how much of each body the project stores.
+func (l *Listener) captureLimit(projectID string) int {
+	if projectID == "" {
+		return models.DefaultMaxBodyBytes
 	}
-	if p == nil {
-		return nil, fmt.Errorf("project not found: %s", projectID)
+	cfg, err := l.loadProjectConfig(projectID)
+	if err != nil {
+		log.Printf("proxy: using default capture limit: %v", err)
+		return models.DefaultMaxBodyBytes
 	}
+	return cfg.MaxBodyBytes
+}
 
-	cfg, err := models.ParseProjectConfig(p.ConfigJSON)
+// redactionPolicy returns the project's redaction policy. Traffic is still
+// redacted with the defaults when the project config can't be loaded.
+//
+// With the vault enabled placeholders are always tokenized, since each one has
+// to identify the original stored for it.
+func (l *Listener) redactionPolicy(projectID string) redaction.Policy {
+	policy, err := store.ProjectRedactionPolicy(l.DB, projectID, l.Vault != nil)
 	if err != nil {
-		return nil, fmt.Errorf("parse project config: %w", err)
+		log.Printf("proxy: using default redaction policy: %v", err)
+		return redaction.DefaultPolicy
+	}
+	return policy
+}
+
+// collectOriginals makes policy record the values it redacts, for the vault.
+// It returns nil when the vault is off or placeholders aren't tokenized.
+func (l *Listener) collectOriginals(policy *redaction.Policy) map[string]string {
+	if l.Vault == nil || len(policy.TokenKey) == 0 {
+		return nil
+	}
+	originals := make(map[string]string)
+	policy.Collect = func(placeholder, original string) {
+		originals[placeholder] = original
+	}
+	return originals
+}
+
+func (l *Listener) storeOriginals(sessionID, eventID string, originals map[string]string) {
+	if len(originals) == 0 {
+		return
+	}
+	if err := l.Vault.Store(l.DB, sessionID, eventID, originals); err != nil {
+		log.Printf("proxy: failed to store redacted values in vault: %v", err)
 	}
-	return cfg, nil
 }
 
 func (l *Listener) persistEvent(
-	sessionID string,
+	t upstreamTarget,
 	startedAt time.Time,
 	endedAt time.Time,
 	req *http.Request,
-	reqBody []byte,
+	reqBody *bodyCapture,
 	statusCode int,
 	respHeaders http.Header,
-	respBody []byte,
+	respBody *bodyCapture,
 	redactionNote string,
-) {
+) *models.Event {
+	sessionID := t.sessionID
 	if sessionID == "" {
-		return
+		return nil
 	}
 
 	s, err := store.GetSession(l.DB, sessionID)
 	if err != nil || s == nil || s.Sealed {
-		return
+		return nil
 	}
 
-	sanitizedReqHeaders, reqRules := redaction.SanitizeHeaders(req.Header, redaction.DefaultPolicy)
-	sanitizedRespHeaders, respRules := redaction.SanitizeHeaders(respHeaders, redaction.DefaultPolicy)
-	sanitizedReqBody, reqBodyRules := sanitizeBodyForStorage(req.Header.Get("Content-Type"), reqBody, "req")
-	respContentType := ""
-	if respHeaders != nil {
-		respContentType = respHeaders.Get("Content-Type")
-	}
-	sanitizedRespBody, respBodyRules := sanitizeBodyForStorage(respContentType, respBody, "resp")
+	policy := l.redactionPolicy(s.ProjectId)
+	originals := l.collectOriginals(&policy)
+	sanitizedReqHeaders, reqRules := redaction.SanitizeHeaders(req.Header, policy)
+	sanitizedRespHeaders, respRules := redaction.SanitizeHeaders(respHeaders, policy)
+	capturedReq := captureBody(req.Header.Get("Content-Type"), reqBody, "req", policy)
+	capturedResp := captureBody(respHeaders.Get("Content-Type"), respBody, "resp", policy)
+	sanitizedURL, urlRules := redaction.SanitizeURL(recordedURL(req), policy)
 
 	var allRules []string
+	allRules = append(allRules, urlRules...)
 	allRules = append(allRules, reqRules...)
 	allRules = append(allRules, respRules...)
-	allRules = append(allRules, reqBodyRules...)
-	allRules = append(allRules, respBodyRules...)
+	allRules = append(allRules, capturedReq.applied...)
+	allRules = append(allRules, capturedResp.applied...)
 
 	finalNote := redactionNote
 	if len(allRules) > 0 {
@@ -293,42 +521,91 @@ func (l *Listener) persistEvent(
 		StartedAt:        startedAt.Format(time.RFC3339Nano),
 		EndedAt:          endedAt.Format(time.RFC3339Nano),
 		Method:           req.Method,
-		URL:              req.URL.RequestURI(),
+		URL:              sanitizedURL,
 		Status:           statusCode,
 		ReqHeaders:       marshalHeaders(sanitizedReqHeaders),
 		RespHeaders:      marshalHeaders(sanitizedRespHeaders),
-		ReqBody:          truncateString(sanitizedReqBody, maxCapturedBodyBytes),
-		RespBody:         truncateString(sanitizedRespBody, maxCapturedBodyBytes),
+		ReqBody:          capturedReq.content,
+		RespBody:         capturedResp.content,
 		RedactionApplied: finalNote,
+		ReqBodyEncoding:  capturedReq.encoding,
+		RespBodyEncoding: capturedResp.encoding,
+		ReqBodySize:      capturedReq.size,
+		RespBodySize:     capturedResp.size,
+		ReqBodySHA256:    capturedReq.sha256,
+		RespBodySHA256:   capturedResp.sha256,
+
+		ReqBodyTruncated:  capturedReq.truncated,
+		RespBodyTruncated: capturedResp.truncated,
+
+		ReqBodyContentEncoding:  capturedReq.contentEncoding,
+		RespBodyContentEncoding: capturedResp.contentEncoding,
+
+		UpstreamRoute: t.route,
 	}
 
 	if err := store.InsertEvent(l.DB, e); err != nil {
 		log.Printf("proxy: failed to persist event: %v", err)
-	} else {
-		if err := store.TouchSessionUpdatedAt(l.DB, sessionID, endedAt.Format(time.RFC3339Nano)); err != nil {
-			log.Printf("proxy: failed to touch session updated_at: %v", err)
-		}
-		if l.EB != nil {
-			l.EB.Publish(control.EventNotification{
-				SessionID:  sessionID,
-				EventID:    e.Id,
-				Method:     e.Method,
-				URL:        e.URL,
-				Status:     e.Status,
-				TotalCount: e.Seq,
-			})
-		}
+		return nil
+	}
+	l.storeOriginals(sessionID, e.Id, originals)
+	if err := store.TouchSessionUpdatedAt(l.DB, sessionID, endedAt.Format(time.RFC3339Nano)); err != nil {
+		log.Printf("proxy: failed to touch session updated_at: %v", err)
+	}
+	if l.EB != nil {
+		l.EB.Publish(control.EventNotification{
+			SessionID:  sessionID,
+			EventID:    e.Id,
+			Method:     e.Method,
+			URL:        e.URL,
+			Status:     e.Status,
+			TotalCount: e.Seq,
+		})
+	}
+	return e
+}
+
+// forwardTarget returns the upstream base URL the client addressed directly,
+// either through an intercepted CONNECT tunnel or an absolute-form request
+// target (e.g. a client configured with HTTP_PROXY).
+func forwardTarget(r *http.Request) (string, bool) {
+	if host, ok := interceptedHost(r.Context()); ok {
+		return "https://" + host, true
+	}
+	if r.URL.IsAbs() && r.URL.Host != "" {
+		return r.URL.Scheme + "://" + r.URL.Host, true
+	}
+	return "", false
+}
+
+// recordedURL is the URL stored on the event: the full URL including host for
+// forwarded requests, since the session may span many hosts, and the request
+// URI otherwise.
+func recordedURL(r *http.Request) string {
+	base, ok := forwardTarget(r)
+	if !ok {
+		return r.URL.RequestURI()
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return r.URL.RequestURI()
 	}
+	if (u.Scheme == "https" && u.Port() == "443") || (u.Scheme == "http" && u.Port() == "80") {
+		u.Host = u.Hostname()
+	}
+	return u.Scheme + "://" + u.Host + r.URL.RequestURI()
 }
 
-func buildUpstreamURL(base string, incoming *url.URL) (string, error) {
+// buildUpstreamURL joins the incoming path, without its leading strip part,
+// onto the upstream base URL.
+func buildUpstreamURL(base string, incoming *url.URL, strip string) (string, error) {
 	u, err := url.Parse(base)
 	if err != nil {
 		return "", err
 	}
 
 	basePath := strings.TrimRight(u.Path, "/")
-	inPath := incoming.Path
+	inPath := strings.TrimPrefix(incoming.Path, strip)
 	if inPath == "" {
 		inPath = "/"
 	}
@@ -387,48 +664,9 @@ func truncateString(b string, limit int) string {
 	return b[:limit]
 }
 
-func sanitizeBodyForStorage(contentType string, body []byte, direction string) (string, []string) {
-	if len(body) == 0 {
-		return "", nil
-	}
-
-	if !captureDecisionGate(body, contentType) {
-		return "", []string{fmt.Sprintf("%s_body_capture_skipped", direction)}
-	}
-
-	sanitized, applied, err := redaction.SanitizeJSON(body)
-	if err != nil {
-		return "", []string{fmt.Sprintf("json:%s_body_parse_failed_dropped", direction)}
-	}
-
-	return string(sanitized), applied
-}
-
-func captureDecisionGate(body []byte, contentType string) bool {
-	if !isJSONContentType(contentType) {
-		return false
-	}
-	if len(body) > maxCapturedBodyBytes {
-		return false
-	}
-	return true
-}
-
-func isJSONContentType(contentType string) bool {
-	trimmed := strings.TrimSpace(contentType)
-	if trimmed == "" {
-		return false
-	}
-
-	mediaType, _, err := mime.ParseMediaType(trimmed)
-	if err != nil {
-		// Fall back to best-effort parse for non-compliant values.
-		parts := strings.SplitN(trimmed, ";", 2)
-		mediaType = strings.TrimSpace(parts[0])
-	}
-
-	mediaType = strings.ToLower(mediaType)
-	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+func isEventStream(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.EqualFold(mediaType, "text/event-stream")
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
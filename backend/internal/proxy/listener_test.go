@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/shigawire-dev/internal/control"
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/upstream"
+)
+
+func TestBuildUpstreamURL(t *testing.T) {
+	cases := []struct {
+		base, incoming, strip, want string
+	}{
+		{"http://app:3000", "/users?page=2", "", "http://app:3000/users?page=2"},
+		{"http://billing:8080/v1/", "/billing/invoices", "/billing", "http://billing:8080/v1/invoices"},
+		{"http://billing:8080", "/billing", "/billing", "http://billing:8080/"},
+		{"https://api.example.com/base", "/api/v12/users?x=1", "/api/v12", "https://api.example.com/base/users?x=1"},
+	}
+	for _, c := range cases {
+		in, err := url.Parse(c.incoming)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := buildUpstreamURL(c.base, in, c.strip)
+		if err != nil || got != c.want {
+			t.Errorf("buildUpstreamURL(%q, %q, %q) = %q, %v; want %q", c.base, c.incoming, c.strip, got, err, c.want)
+		}
+	}
+}
+
+// An upstream that answers before reading the request leaves the transport
+// sending the body while the response is proxied; run with -race.
+func TestProxyRecordsEarlyResponse(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("early"))
+	}))
+	defer up.Close()
+	u, _ := url.Parse(up.URL)
+
+	db := openTestDB(t)
+	cfg := fmt.Sprintf(`{"targetScheme":"http","targetHost":"127.0.0.1","targetPort":%s}`, u.Port())
+	if err := store.InsertProject(db, &models.Project{Id: "p", Name: "p", ConfigJSON: cfg}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertSession(db, &models.Session{Id: "s", ProjectId: "p", Name: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := control.NewRecordingState(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.Start("p", "s", models.RecordingRoute{}); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Listener{DB: db, Rec: rec, Upstreams: upstream.NewPool(nil)}
+	proxy := httptest.NewServer(http.HandlerFunc(l.handleProxy))
+	defer proxy.Close()
+
+	body := strings.Repeat("x", 4<<20)
+	for i := 0; i < 5; i++ {
+		resp, err := http.Post(proxy.URL+"/upload", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !bytes.Equal(got, []byte("early")) {
+			t.Fatalf("response = %q", got)
+		}
+	}
+
+	events, err := store.ListEventsBySession(db, "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("recorded %d events, want 5", len(events))
+	}
+	for _, e := range events {
+		if e.Status != http.StatusOK || e.ReqBodySize > len(body) {
+			t.Errorf("event %s: status %d, request body size %d", e.Id, e.Status, e.ReqBodySize)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/shigawire-dev/internal/certs"
+	"github.com/shigawire-dev/internal/control"
+	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/vault"
+)
+
+// Manager runs the shared proxy listener and one listener for each project
+// with a listenPort, rebinding them as projects are created, updated and
+// deleted.
+type Manager struct {
+	Shared *Listener
+
+	mu       sync.Mutex
+	ctx      context.Context
+	projects map[string]*projectListener
+}
+
+type projectListener struct {
+	port int
+	stop func()
+}
+
+func NewManagerFromEnv(db *sql.DB, rec *control.RecordingState, pb *control.PlaybackState, eb *control.EventBus, ca *certs.CA, v *vault.Vault) *Manager {
+	return &Manager{
+		Shared:   NewListenerFromEnv(db, rec, pb, eb, ca, v),
+		projects: make(map[string]*projectListener),
+	}
+}
+
+// Start binds the listeners of the projects that have a listenPort and then
+// serves the shared listener until ctx is done. A project whose port can't be
+// bound is logged and left without a listener.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	projects, err := store.ListProjects(m.Shared.DB)
+	if err != nil {
+		return fmt.Errorf("list projects: %w", err)
+	}
+	for _, p := range projects {
+		if err := m.SyncProject(p.Id); err != nil {
+			log.Printf("proxy: no listener for project %s: %v", p.Id, err)
+		}
+	}
+	return m.Shared.Start(ctx)
+}
+
+// SyncProject makes the project's listener match its stored config: it is
+// started, moved to a new port, or stopped when the project no longer has a
+// listenPort or no longer exists.
+func (m *Manager) SyncProject(projectId string) error {
+	// The config may have been changed; read it again.
+	store.ForgetProjectConfig(m.Shared.DB, projectId)
+
+	port := 0
+	p, err := store.GetProject(m.Shared.DB, projectId)
+	if err != nil {
+		return fmt.Errorf("load project: %w", err)
+	}
+	if p != nil {
+		cfg, err := store.GetProjectConfig(m.Shared.DB, projectId)
+		if err != nil {
+			return err
+		}
+		port = cfg.ListenPort
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Before Start, the projects are synced from the store once it runs.
+	if m.ctx == nil {
+		return nil
+	}
+
+	if cur, ok := m.projects[projectId]; ok {
+		if cur.port == port {
+			return nil
+		}
+		cur.stop()
+		delete(m.projects, projectId)
+	}
+	if port == 0 {
+		return nil
+	}
+
+	if port == m.sharedPort() {
+		return fmt.Errorf("listenPort %d is the shared proxy port", port)
+	}
+	for id, other := range m.projects {
+		if other.port == port {
+			return fmt.Errorf("listenPort %d is used by project %s", port, id)
+		}
+	}
+
+	l := &Listener{
+		Addr:      ":" + strconv.Itoa(port),
+		ProjectID: projectId,
+		DB:        m.Shared.DB,
+		Rec:       m.Shared.Rec,
+		PB:        m.Shared.PB,
+		EB:        m.Shared.EB,
+		CA:        m.Shared.CA,
+		Vault:     m.Shared.Vault,
+		Upstreams: m.Shared.Upstreams,
+	}
+	ln, err := net.Listen("tcp", l.Addr)
+	if err != nil {
+		return fmt.Errorf("listen on port %d: %w", port, err)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := l.Serve(ctx, ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("proxy: listener for project %s failed: %v", projectId, err)
+		}
+	}()
+	log.Printf("Proxy for project %s started on: %s", projectId, l.Addr)
+
+	// Serve returns once the port is released, so it can be bound again
+	// right away.
+	m.projects[projectId] = &projectListener{port: port, stop: func() {
+		cancel()
+		<-done
+	}}
+	return nil
+}
+
+// RemoveProject stops the listener of a deleted project and drops its
+// upstream connections.
+func (m *Manager) RemoveProject(projectId string) {
+	store.ForgetProjectConfig(m.Shared.DB, projectId)
+	m.Shared.Upstreams.Forget(projectId)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.projects[projectId]; ok {
+		cur.stop()
+		delete(m.projects, projectId)
+	}
+}
+
+func (m *Manager) sharedPort() int {
+	_, port, err := net.SplitHostPort(m.Shared.Addr)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
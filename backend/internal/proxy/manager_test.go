@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/upstream"
+)
+
+// freePort returns a TCP port that was free a moment ago.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func listening(port int) bool {
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(port), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// newTestManager returns a manager ready to sync projects, without serving
+// the shared listener.
+func newTestManager(t *testing.T, db *sql.DB) *Manager {
+	m := &Manager{
+		Shared:   &Listener{Addr: ":" + strconv.Itoa(freePort(t)), DB: db, Upstreams: upstream.NewPool(nil)},
+		projects: make(map[string]*projectListener),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.ctx = ctx
+	t.Cleanup(func() {
+		for _, id := range []string{"p1", "p2"} {
+			m.RemoveProject(id)
+		}
+		cancel()
+	})
+	return m
+}
+
+// putProject stores a project whose own proxy port is listenPort.
+func putProject(t *testing.T, db *sql.DB, id string, listenPort int) {
+	t.Helper()
+	p := &models.Project{
+		Id:         id,
+		Name:       id,
+		ConfigJSON: fmt.Sprintf(`{"targetScheme":"http","targetHost":"app","targetPort":80,"listenPort":%d}`, listenPort),
+	}
+	existing, err := store.GetProject(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing == nil {
+		err = store.InsertProject(db, p)
+	} else {
+		err = store.UpdateProject(db, p)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerSyncProject(t *testing.T) {
+	db := openTestDB(t)
+	m := newTestManager(t, db)
+	first, second, taken := freePort(t), freePort(t), freePort(t)
+
+	putProject(t, db, "p1", first)
+	if err := m.SyncProject("p1"); err != nil || !listening(first) {
+		t.Fatalf("p1 on %d: %v", first, err)
+	}
+
+	// Moving the project releases its old port.
+	putProject(t, db, "p1", second)
+	if err := m.SyncProject("p1"); err != nil || !listening(second) {
+		t.Fatalf("p1 moved to %d: %v", second, err)
+	}
+	if listening(first) {
+		t.Errorf("port %d still bound after p1 moved", first)
+	}
+
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(taken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conflicts := map[int]string{
+		second:         "is used by project p1",
+		m.sharedPort(): "is the shared proxy port",
+		taken:          "listen on port",
+	}
+	for port, want := range conflicts {
+		putProject(t, db, "p2", port)
+		if err := m.SyncProject("p2"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("p2 on %d: err = %v, want %q", port, err, want)
+		}
+		if _, ok := m.projects["p2"]; ok {
+			t.Errorf("p2 on %d got a listener", port)
+		}
+	}
+
+	putProject(t, db, "p1", 0)
+	if err := m.SyncProject("p1"); err != nil {
+		t.Fatal(err)
+	}
+	if listening(second) {
+		t.Errorf("port %d still bound after p1 dropped its listenPort", second)
+	}
+}
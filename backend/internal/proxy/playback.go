@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+	"github.com/shigawire-dev/internal/store"
+)
+
+// playbackIndex groups a sealed session's events by request shape so the
+// listener can answer incoming requests without contacting the upstream.
+// Repeated identical requests are answered with the recorded responses in seq
+// order; once exhausted, the last recorded response keeps being served.
+type playbackIndex struct {
+	mu       sync.Mutex
+	playback models.Playback
+	byURL    map[string][]*models.Event
+	byURI    map[string][]*models.Event
+	byPath   map[string][]*models.Event
+	cursors  map[string]int
+}
+
+func newPlaybackIndex(p models.Playback, events []*models.Event) *playbackIndex {
+	idx := &playbackIndex{
+		playback: p,
+		byURL:    make(map[string][]*models.Event),
+		byURI:    make(map[string][]*models.Event),
+		byPath:   make(map[string][]*models.Event),
+		cursors:  make(map[string]int),
+	}
+	for _, e := range events {
+		urlKey := e.Method + " " + e.URL
+		idx.byURL[urlKey] = append(idx.byURL[urlKey], e)
+
+		uriKey := e.Method + " " + stripSchemeHost(e.URL)
+		idx.byURI[uriKey] = append(idx.byURI[uriKey], e)
+
+		pathKey := e.Method + " " + stripQuery(stripSchemeHost(e.URL))
+		idx.byPath[pathKey] = append(idx.byPath[pathKey], e)
+	}
+	return idx
+}
+
+// match returns the next recorded event for the request. An exact match on the
+// recorded URL (including host for forwarded traffic) wins, then method + path
+// + query regardless of host, and finally the query string is ignored.
+func (idx *playbackIndex) match(method, recordedURL string) *models.Event {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	urlKey := method + " " + recordedURL
+	if events, ok := idx.byURL[urlKey]; ok {
+		return idx.next("url:"+urlKey, events)
+	}
+
+	requestURI := stripSchemeHost(recordedURL)
+	uriKey := method + " " + requestURI
+	if events, ok := idx.byURI[uriKey]; ok {
+		return idx.next("uri:"+uriKey, events)
+	}
+
+	pathKey := method + " " + stripQuery(requestURI)
+	if events, ok := idx.byPath[pathKey]; ok {
+		return idx.next("path:"+pathKey, events)
+	}
+	return nil
+}
+
+// next advances the cursor for key. Caller must hold idx.mu.
+func (idx *playbackIndex) next(key string, events []*models.Event) *models.Event {
+	i := idx.cursors[key]
+	if i >= len(events) {
+		return events[len(events)-1]
+	}
+	idx.cursors[key] = i + 1
+	return events[i]
+}
+
+// playbackFor returns the playback that answers r, if any. A project listener
+// only plays back its own project. On the shared listener a request naming a
+// project or a playing session is answered by that playback, one a recording
+// captures is forwarded, and any other goes to the newest playback.
+func (l *Listener) playbackFor(r *http.Request) (models.Playback, bool) {
+	if l.PB == nil {
+		return models.Playback{}, false
+	}
+	if l.ProjectID != "" {
+		return l.PB.Get(l.ProjectID)
+	}
+	if projectID := strings.TrimSpace(r.Header.Get("X-Shigawire-Project-Id")); projectID != "" {
+		return l.PB.Get(projectID)
+	}
+
+	playbacks := l.PB.List()
+	if len(playbacks) == 0 {
+		return models.Playback{}, false
+	}
+	if header := r.Header.Get(models.SessionHeader); header != "" {
+		for _, p := range playbacks {
+			if p.SessionId == header {
+				return p, true
+			}
+		}
+	}
+	if _, recording := l.Rec.Match(r); recording {
+		return models.Playback{}, false
+	}
+	return playbacks[len(playbacks)-1], true
+}
+
+// playbackIndexFor returns the cached index for p, rebuilding it when the
+// project's playback was restarted or switched to a different session, so a
+// new playback starts again from the first recorded response.
+func (l *Listener) playbackIndexFor(p models.Playback) (*playbackIndex, error) {
+	l.playbackMu.Lock()
+	defer l.playbackMu.Unlock()
+
+	if idx := l.playbacks[p.ProjectId]; idx != nil && idx.playback == p {
+		return idx, nil
+	}
+
+	events, err := store.ListEventsBySession(l.DB, p.SessionId)
+	if err != nil {
+		return nil, fmt.Errorf("load playback events: %w", err)
+	}
+	if l.playbacks == nil {
+		l.playbacks = make(map[string]*playbackIndex)
+	}
+	idx := newPlaybackIndex(p, events)
+	l.playbacks[p.ProjectId] = idx
+	return idx, nil
+}
+
+func (l *Listener) servePlayback(w http.ResponseWriter, r *http.Request, p models.Playback) {
+	projectId, sessionId := p.ProjectId, p.SessionId
+	idx, err := l.playbackIndexFor(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Recorded URLs had their query values redacted; match on the same form.
+	matchURL, _ := redaction.SanitizeURL(recordedURL(r), l.redactionPolicy(projectId))
+	e := idx.match(r.Method, matchURL)
+	if e == nil {
+		w.Header().Set("X-Shigawire-Playback", "miss")
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error":  "no recorded response matches request",
+			"method": r.Method,
+			"url":    r.URL.RequestURI(),
+		})
+		return
+	}
+
+	var headers http.Header
+	if e.RespHeaders != "" {
+		_ = json.Unmarshal([]byte(e.RespHeaders), &headers)
+	}
+
+	if e.Status == http.StatusSwitchingProtocols && isWebSocketUpgrade(r) {
+		l.playWebSocket(w, r, e, headers)
+		return
+	}
+
+	restore := l.vaultResolver(sessionId)
+	for _, values := range headers {
+		for i, v := range values {
+			values[i] = redaction.ReplacePlaceholders(v, restore)
+		}
+	}
+
+	copyHeaders(w.Header(), headers)
+	removeHopByHopHeaders(w.Header())
+	w.Header().Del("Content-Length")
+	if e.RespBodyContentEncoding != "" {
+		// The body was stored decoded and is served that way.
+		w.Header().Del("Content-Encoding")
+	}
+	w.Header().Set("X-Shigawire-Playback", "hit")
+	w.Header().Set("X-Shigawire-Event-Id", e.Id)
+
+	status := e.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := []byte(redaction.RestoreBody(e.RespBody, restore))
+	if e.RespBodyEncoding == models.BodyEncodingBase64 {
+		if body, err = models.DecodeBody(e.RespBody, e.RespBodyEncoding); err != nil {
+			http.Error(w, "failed to decode recorded body", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// vaultResolver returns the original behind a placeholder recorded in
+// sessionId. Without the vault nothing is resolved and placeholders are served
+// as recorded.
+func (l *Listener) vaultResolver(sessionId string) func(placeholder string) (string, bool) {
+	return func(placeholder string) (string, bool) {
+		if l.Vault == nil || !redaction.IsTokenized(placeholder) {
+			return "", false
+		}
+		v, ok, err := l.Vault.Lookup(l.DB, sessionId, placeholder)
+		if err != nil {
+			log.Printf("proxy: vault lookup: %v", err)
+		}
+		return v, ok
+	}
+}
+
+// stripSchemeHost reduces a recorded URL to its request URI.
+func stripSchemeHost(recorded string) string {
+	if u, err := url.Parse(recorded); err == nil && u.IsAbs() {
+		return u.RequestURI()
+	}
+	return recorded
+}
+
+func stripQuery(uri string) string {
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		return uri[:i]
+	}
+	return uri
+}
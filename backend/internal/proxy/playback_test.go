@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/shigawire-dev/internal/control"
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/store"
+)
+
+func TestPlaybackIndexMatch(t *testing.T) {
+	events := []*models.Event{
+		{Id: "list-1", Method: "GET", URL: "/users?page=1"},
+		{Id: "list-2", Method: "GET", URL: "/users?page=2"},
+		{Id: "remote", Method: "GET", URL: "http://api.example.com/users?page=1"},
+		{Id: "create-1", Method: "POST", URL: "/users"},
+		{Id: "create-2", Method: "POST", URL: "/users"},
+	}
+	idx := newPlaybackIndex(models.Playback{ProjectId: "p", SessionId: "s"}, events)
+
+	cases := []struct {
+		method, url, want string
+	}{
+		// The recorded URL, host included, wins.
+		{"GET", "http://api.example.com/users?page=1", "remote"},
+		// Then method, path and query regardless of host.
+		{"GET", "/users?page=2", "list-2"},
+		{"GET", "http://other.example.com/users?page=2", "list-2"},
+		// Then the path alone, in recording order.
+		{"GET", "/users?page=9", "list-1"},
+		{"GET", "/users?page=9", "list-2"},
+		// Repeated requests get the recorded responses in order, then the last.
+		{"POST", "/users", "create-1"},
+		{"POST", "/users", "create-2"},
+		{"POST", "/users", "create-2"},
+		{"DELETE", "/users", ""},
+		{"GET", "/groups", ""},
+	}
+	for _, c := range cases {
+		got := ""
+		if e := idx.match(c.method, c.url); e != nil {
+			got = e.Id
+		}
+		if got != c.want {
+			t.Errorf("match(%s %s) = %q, want %q", c.method, c.url, got, c.want)
+		}
+	}
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := store.OpenDB(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := store.InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func insertProjectSession(t *testing.T, db *sql.DB, projectId, sessionId string) {
+	t.Helper()
+	if err := store.InsertProject(db, &models.Project{Id: projectId, Name: projectId, ConfigJSON: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertSession(db, &models.Session{Id: sessionId, ProjectId: projectId, Name: sessionId}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlaybackFor(t *testing.T) {
+	db := openTestDB(t)
+	insertProjectSession(t, db, "proj-a", "sess-a")
+	insertProjectSession(t, db, "proj-b", "sess-b")
+	insertProjectSession(t, db, "proj-c", "sess-c")
+
+	pb, err := control.NewPlaybackState(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := control.NewRecordingState(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pb.Start("proj-a", "sess-a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pb.Start("proj-b", "sess-b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rec.Start("proj-c", "sess-c", models.RecordingRoute{Kind: models.RoutePathPrefix, Value: "/c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := &Listener{PB: pb, Rec: rec}
+	cases := []struct {
+		name     string
+		listener *Listener
+		path     string
+		headers  map[string]string
+		want     string
+	}{
+		{"newest playback by default", shared, "/x", nil, "sess-b"},
+		{"project header", shared, "/x", map[string]string{"X-Shigawire-Project-Id": "proj-a"}, "sess-a"},
+		{"project header of a project not playing back", shared, "/x", map[string]string{"X-Shigawire-Project-Id": "proj-c"}, ""},
+		{"session header", shared, "/x", map[string]string{models.SessionHeader: "sess-a"}, "sess-a"},
+		{"recorded requests are forwarded", shared, "/c/x", nil, ""},
+		{"project listener", &Listener{PB: pb, Rec: rec, ProjectID: "proj-a"}, "/c/x", nil, "sess-a"},
+		{"project listener without playback", &Listener{PB: pb, Rec: rec, ProjectID: "proj-c"}, "/x", nil, ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.path, nil)
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		got := ""
+		if p, ok := c.listener.playbackFor(r); ok {
+			got = p.SessionId
+		}
+		if got != c.want {
+			t.Errorf("%s: playback %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	if err := pb.Stop("proj-b"); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := shared.playbackFor(httptest.NewRequest("GET", "/x", nil)); !ok || p.SessionId != "sess-a" {
+		t.Errorf("after stopping proj-b: playback %+v, %v; want sess-a", p, ok)
+	}
+}
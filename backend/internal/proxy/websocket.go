@@ -0,0 +1,379 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+	"github.com/shigawire-dev/internal/store"
+)
+
+// How long to wait for the second side of a connection to finish its close
+// handshake once the first side has gone away.
+const wsCloseGrace = 5 * time.Second
+
+var wsUpgrader = websocket.Upgrader{
+	// The proxy sits in front of the real server, which is the one entitled to
+	// enforce an origin policy; it sees the client's Origin header unchanged.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// isWebSocketUpgrade reports whether r asks to switch to the WebSocket protocol.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") &&
+		headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyWebSocket completes the handshake with the upstream first, so a refused
+// upgrade reaches the client as the upstream's own response, then relays
+// messages in both directions. When recording, the handshake is stored as an
+// event and every message as a frame belonging to it.
+func (l *Listener) proxyWebSocket(w http.ResponseWriter, r *http.Request, targetURL string, t upstreamTarget, transport *http.Transport) {
+	startedAt := time.Now().UTC()
+
+	dial := &wsUpstreamDial{transport: transport}
+	dialer := dial.dialer()
+	dialer.HandshakeTimeout = 30 * time.Second
+
+	upConn, upResp, err := dialer.DialContext(r.Context(), webSocketURL(targetURL), webSocketDialHeaders(r.Header))
+	if errors.Is(err, websocket.ErrBadHandshake) {
+		// The upstream answered but declined the upgrade; pass that answer on.
+		upResp, err = dial.refusedResponse(upResp.Request)
+		if err == nil {
+			l.relayRefusedUpgrade(w, r, t, startedAt, upResp)
+			return
+		}
+	}
+	if err != nil {
+		dial.close()
+		if t.record {
+			l.persistEvent(t, startedAt, time.Now().UTC(), r, nil, 502, nil, nil, "upstream_error:"+err.Error())
+		}
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		return
+	}
+	dial.finish()
+
+	respHeader := http.Header{}
+	if p := upResp.Header.Get("Sec-WebSocket-Protocol"); p != "" {
+		respHeader.Set("Sec-WebSocket-Protocol", p)
+	}
+	for _, c := range upResp.Header.Values("Set-Cookie") {
+		respHeader.Add("Set-Cookie", c)
+	}
+
+	clientConn, err := wsUpgrader.Upgrade(w, r, respHeader)
+	if err != nil {
+		// Upgrade has already written an error response to the client.
+		_ = upConn.Close()
+		return
+	}
+
+	var frames *frameRecorder
+	if t.record {
+		if e := l.persistEvent(t, startedAt, time.Now().UTC(), r, nil, upResp.StatusCode, upResp.Header, nil, ""); e != nil {
+			frames = &frameRecorder{l: l, sessionId: t.sessionID, eventId: e.Id, policy: l.redactionPolicy(t.projectID), limit: l.captureLimit(t.projectID)}
+		}
+	}
+
+	relayControlFrames(clientConn, upConn, models.WSDirectionClient, frames)
+	relayControlFrames(upConn, clientConn, models.WSDirectionServer, frames)
+
+	done := make(chan struct{}, 2)
+	go pumpWebSocket(clientConn, upConn, models.WSDirectionClient, frames, done)
+	go pumpWebSocket(upConn, clientConn, models.WSDirectionServer, frames, done)
+
+	<-done
+	select {
+	case <-done:
+	case <-time.After(wsCloseGrace):
+	}
+	_ = clientConn.Close()
+	_ = upConn.Close()
+
+	if frames != nil {
+		if err := store.UpdateEventEndedAt(l.DB, frames.eventId, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+			log.Printf("proxy: failed to update websocket event: %v", err)
+		}
+	}
+}
+
+// relayRefusedUpgrade passes the upstream's answer to a refused upgrade on to
+// the client. The body streams through in full; only the capture is limited.
+func (l *Listener) relayRefusedUpgrade(w http.ResponseWriter, r *http.Request, t upstreamTarget, startedAt time.Time, upResp *http.Response) {
+	defer upResp.Body.Close()
+
+	copyHeaders(w.Header(), upResp.Header)
+	removeHopByHopHeaders(w.Header())
+	w.WriteHeader(upResp.StatusCode)
+
+	var body io.Reader = upResp.Body
+	var capture *bodyCapture
+	if t.record {
+		capture = newBodyCapture(l.captureLimit(t.projectID), upResp.Header.Get("Content-Encoding"))
+		defer capture.finish()
+		body = io.TeeReader(upResp.Body, capture)
+	}
+	streamNote := ""
+	if err := copyResponse(w, body, upResp); err != nil {
+		streamNote = "stream_interrupted:" + err.Error()
+	}
+	if t.record {
+		l.persistEvent(t, startedAt, time.Now().UTC(), r, nil, upResp.StatusCode, upResp.Header, capture, streamNote)
+	}
+}
+
+// pumpWebSocket copies data messages from src to dst until src closes, then
+// passes the close frame on so both ends see the same close code.
+func pumpWebSocket(src, dst *websocket.Conn, direction string, frames *frameRecorder, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+
+	for {
+		msgType, data, err := src.ReadMessage()
+		if err != nil {
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseAbnormalClosure, "")
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				closeMsg = websocket.FormatCloseMessage(ce.Code, ce.Text)
+				if ce.Code == websocket.CloseNoStatusReceived {
+					closeMsg = []byte{}
+				}
+				frames.record(direction, models.WSOpcodeClose, closeMsg)
+			}
+			_ = dst.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+			return
+		}
+
+		frames.record(direction, msgType, data)
+		if err := dst.WriteMessage(msgType, data); err != nil {
+			return
+		}
+	}
+}
+
+// relayControlFrames forwards pings and pongs read from src to dst instead of
+// answering them locally, so keepalives reach the real peer.
+func relayControlFrames(src, dst *websocket.Conn, direction string, frames *frameRecorder) {
+	src.SetPingHandler(func(data string) error {
+		frames.record(direction, models.WSOpcodePing, []byte(data))
+		return ignoreClosed(dst.WriteControl(websocket.PingMessage, []byte(data), time.Now().Add(time.Second)))
+	})
+	src.SetPongHandler(func(data string) error {
+		frames.record(direction, models.WSOpcodePong, []byte(data))
+		return ignoreClosed(dst.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second)))
+	})
+}
+
+func ignoreClosed(err error) error {
+	if errors.Is(err, websocket.ErrCloseSent) {
+		return nil
+	}
+	return err
+}
+
+// frameRecorder stores the messages of one proxied connection under its event.
+// A nil recorder records nothing.
+type frameRecorder struct {
+	l         *Listener
+	sessionId string
+	eventId   string
+	policy    redaction.Policy
+	limit     int
+
+	mu  sync.Mutex
+	seq int
+}
+
+func (fr *frameRecorder) record(direction string, opcode int, data []byte) {
+	if fr == nil {
+		return
+	}
+
+	policy := fr.policy
+	originals := fr.l.collectOriginals(&policy)
+	payload, encoding, note := sanitizeFrameForStorage(opcode, data, fr.limit, policy)
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.seq++
+
+	f := &models.WSFrame{
+		Id:               "frame_" + uuid.NewString(),
+		EventId:          fr.eventId,
+		Seq:              fr.seq,
+		Direction:        direction,
+		Opcode:           opcode,
+		Timestamp:        time.Now().UTC().Format(time.RFC3339Nano),
+		Payload:          payload,
+		PayloadEncoding:  encoding,
+		Size:             len(data),
+		RedactionApplied: note,
+	}
+	if err := store.InsertWSFrame(fr.l.DB, f); err != nil {
+		log.Printf("proxy: failed to persist websocket frame: %v", err)
+		return
+	}
+	fr.l.storeOriginals(fr.sessionId, fr.eventId, originals)
+}
+
+// sanitizeFrameForStorage applies the body redaction policy to JSON text
+// messages and the value rules to other text. Binary and control payloads are
+// stored base64-encoded. Payloads longer than limit are stored truncated, like
+// bodies.
+func sanitizeFrameForStorage(opcode int, data []byte, limit int, policy redaction.Policy) (payload, encoding, note string) {
+	if len(data) == 0 {
+		return "", "", ""
+	}
+	if len(data) > limit {
+		contentType := "application/octet-stream"
+		if opcode == models.WSOpcodeText {
+			contentType = "text/plain"
+			if t := bytes.TrimLeft(data, " \t\r\n"); len(t) > 0 && (t[0] == '{' || t[0] == '[') {
+				contentType = "application/json"
+			}
+		}
+		payload, encoding, applied := redaction.SanitizeTruncatedBody(contentType, data[:limit], "frame", policy)
+		return payload, encoding, strings.Join(append(applied, "frame_payload_truncated"), ", ")
+	}
+
+	if opcode != models.WSOpcodeText {
+		return base64.StdEncoding.EncodeToString(data), "base64", ""
+	}
+
+	if json.Valid(data) {
+		sanitized, applied, err := redaction.SanitizeJSON(data, policy)
+		if err != nil {
+			return "", "", "json:frame_payload_parse_failed_dropped"
+		}
+		return string(sanitized), "text", strings.Join(applied, ", ")
+	}
+	text, applied := redaction.SanitizeText(string(data), policy)
+	var notes []string
+	for _, name := range applied {
+		notes = append(notes, "text:"+name)
+	}
+	return text, "text", strings.Join(notes, ", ")
+}
+
+// webSocketDialHeaders is the client's handshake minus the headers the dialer
+// generates itself. Extensions are not negotiated so frames pass through
+// unmodified.
+func webSocketDialHeaders(in http.Header) http.Header {
+	h := http.Header{}
+	copyHeaders(h, in)
+	removeHopByHopHeaders(h)
+	h.Del("Host")
+	h.Del("Sec-WebSocket-Key")
+	h.Del("Sec-WebSocket-Version")
+	h.Del("Sec-WebSocket-Extensions")
+	return h
+}
+
+// webSocketURL maps an http(s) upstream URL onto the matching ws(s) scheme.
+func webSocketURL(target string) string {
+	switch {
+	case strings.HasPrefix(target, "https://"):
+		return "wss://" + strings.TrimPrefix(target, "https://")
+	case strings.HasPrefix(target, "http://"):
+		return "ws://" + strings.TrimPrefix(target, "http://")
+	}
+	return target
+}
+
+// playWebSocket answers a WebSocket upgrade during playback by sending the
+// recorded server messages with their original spacing. Client messages are
+// read and discarded.
+func (l *Listener) playWebSocket(w http.ResponseWriter, r *http.Request, e *models.Event, recordedHeaders http.Header) {
+	frames, err := store.ListWSFramesByEvent(l.DB, e.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respHeader := http.Header{}
+	if p := recordedHeaders.Get("Sec-WebSocket-Protocol"); p != "" {
+		respHeader.Set("Sec-WebSocket-Protocol", p)
+	}
+	respHeader.Set("X-Shigawire-Playback", "hit")
+	respHeader.Set("X-Shigawire-Event-Id", e.Id)
+
+	conn, err := wsUpgrader.Upgrade(w, r, respHeader)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	clientGone := make(chan struct{})
+	go func() {
+		defer close(clientGone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	restore := l.vaultResolver(e.SessionId)
+	last, _ := time.Parse(time.RFC3339Nano, e.StartedAt)
+	for _, f := range frames {
+		if f.Direction != models.WSDirectionServer {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339Nano, f.Timestamp); err == nil && at.After(last) {
+			select {
+			case <-time.After(at.Sub(last)):
+			case <-clientGone:
+				return
+			}
+			last = at
+		}
+
+		data := []byte(redaction.RestoreBody(f.Payload, restore))
+		if f.PayloadEncoding == "base64" {
+			if data, err = base64.StdEncoding.DecodeString(f.Payload); err != nil {
+				continue
+			}
+		}
+
+		switch f.Opcode {
+		case models.WSOpcodeText, models.WSOpcodeBinary:
+			err = conn.WriteMessage(f.Opcode, data)
+		case models.WSOpcodePing:
+			err = conn.WriteControl(websocket.PingMessage, data, time.Now().Add(time.Second))
+		case models.WSOpcodeClose:
+			_ = conn.WriteControl(websocket.CloseMessage, data, time.Now().Add(time.Second))
+			<-clientGone
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	// The recording ended without the server closing; leave the connection to
+	// the client.
+	<-clientGone
+}
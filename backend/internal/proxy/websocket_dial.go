@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/shigawire-dev/internal/upstream"
+)
+
+// wsUpstreamDial connects to a WebSocket upstream through a project
+// transport's proxy and TLS settings. The websocket package reads only the
+// start of the response to a refused upgrade before it closes the connection,
+// so the connection is kept open and what was read of it is kept, and
+// refusedResponse can read the whole response again.
+type wsUpstreamDial struct {
+	transport *http.Transport
+	conn      *handshakeConn
+}
+
+func (d *wsUpstreamDial) dialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d.dial(ctx, network, addr, false)
+		},
+		NetDialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d.dial(ctx, network, addr, true)
+		},
+	}
+}
+
+func (d *wsUpstreamDial) dial(ctx context.Context, network, addr string, useTLS bool) (net.Conn, error) {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	var proxyURL *url.URL
+	if d.transport.Proxy != nil {
+		var err error
+		proxyURL, err = d.transport.Proxy(&http.Request{URL: &url.URL{Scheme: scheme, Host: addr}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dialAddr := addr
+	if proxyURL != nil {
+		if proxyURL.Scheme != "http" {
+			return nil, fmt.Errorf("unsupported proxy scheme %q for websocket upstreams", proxyURL.Scheme)
+		}
+		dialAddr = proxyURL.Host
+		if proxyURL.Port() == "" {
+			dialAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+	}
+
+	dial := d.transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, network, dialAddr)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		if err := connectTunnel(conn, proxyURL, addr); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if useTLS {
+		cfg := upstream.WebSocketTLSConfig(d.transport)
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	d.conn = &handshakeConn{Conn: conn}
+	return d.conn, nil
+}
+
+// connectTunnel asks an HTTP proxy on conn for a tunnel to addr.
+func connectTunnel(conn net.Conn, proxyURL *url.URL, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	// The proxy sends nothing more until the tunnel is used.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy refused tunnel: %s", resp.Status)
+	}
+	return nil
+}
+
+// finish stops keeping a copy of what is read once the upgrade succeeded; the
+// connection is closed as usual from then on.
+func (d *wsUpstreamDial) finish() {
+	if d.conn != nil {
+		d.conn.done = true
+		d.conn.read = bytes.Buffer{}
+	}
+}
+
+// close closes the connection of a failed handshake.
+func (d *wsUpstreamDial) close() {
+	if d.conn != nil {
+		d.finish()
+		_ = d.conn.Close()
+	}
+}
+
+// refusedResponse reads the upstream's answer to a refused upgrade again,
+// from the start, with the whole body. The caller closes the body, which
+// closes the connection.
+func (d *wsUpstreamDial) refusedResponse(r *http.Request) (*http.Response, error) {
+	if d.conn == nil {
+		return nil, fmt.Errorf("no upstream connection")
+	}
+	c := d.conn
+	read := bytes.NewReader(c.read.Bytes())
+	d.finish()
+	// Drop the handshake deadline; the body may take longer.
+	_ = c.SetDeadline(time.Time{})
+
+	br := bufio.NewReader(io.MultiReader(read, c.Conn))
+	resp, err := http.ReadResponse(br, r)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{resp.Body, closers{resp.Body, c}}
+	return resp, nil
+}
+
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	for _, c := range cs {
+		_ = c.Close()
+	}
+	return nil
+}
+
+// handshakeConn keeps a copy of what is read from it, and ignores Close,
+// until done is set.
+type handshakeConn struct {
+	net.Conn
+	read bytes.Buffer
+	done bool
+}
+
+func (c *handshakeConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if !c.done {
+		c.read.Write(p[:n])
+	}
+	return n, err
+}
+
+func (c *handshakeConn) Close() error {
+	if !c.done {
+		return nil
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+func TestSanitizeFrameForStorage(t *testing.T) {
+	policy := redaction.Policy{
+		JSONKeyDenylist: []redaction.JSONKeyRule{{Key: "token"}},
+		ValueRules:      []redaction.ValueRule{{Name: "bearer_token", Detector: redaction.DetectorBearerToken}},
+	}
+	binary := []byte{0x00, 0x01, 0xfe, 0xff}
+	long := "Bearer abcdefgh12345678 " + strings.Repeat("x", 100)
+
+	cases := []struct {
+		name                    string
+		opcode                  int
+		data                    string
+		limit                   int
+		payload, encoding, note string
+	}{
+		{"json", models.WSOpcodeText, `{"token":"t","a":1}`, 100,
+			`{"a":1,"token":"[REDACTED]"}`, "text", "json:token"},
+		{"text", models.WSOpcodeText, "auth Bearer abcdefgh12345678", 100,
+			"auth Bearer [REDACTED]", "text", "text:bearer_token"},
+		{"binary", models.WSOpcodeBinary, string(binary), 100,
+			base64.StdEncoding.EncodeToString(binary), "base64", ""},
+		{"empty", models.WSOpcodeText, "", 100, "", "", ""},
+		{"long text", models.WSOpcodeText, long, 40,
+			"Bearer [REDACTED] ", "text", "text:bearer_token, frame_payload_truncated"},
+		{"long json", models.WSOpcodeText, ` {"token":"` + long + `"}`, 40,
+			"", "", "json:frame_body_truncated_dropped, frame_payload_truncated"},
+		{"long binary", models.WSOpcodeBinary, string(binary), 2,
+			base64.StdEncoding.EncodeToString(binary[:2]), "base64", "frame_payload_truncated"},
+	}
+	for _, c := range cases {
+		payload, encoding, note := sanitizeFrameForStorage(c.opcode, []byte(c.data), c.limit, policy)
+		if payload != c.payload || encoding != c.encoding || note != c.note {
+			t.Errorf("%s: got %q, %q, %q; want %q, %q, %q",
+				c.name, payload, encoding, note, c.payload, c.encoding, c.note)
+		}
+	}
+}
+
+func TestWebSocketURL(t *testing.T) {
+	cases := map[string]string{
+		"http://app:3000/ws?x=1":  "ws://app:3000/ws?x=1",
+		"https://api.example.com": "wss://api.example.com",
+	}
+	for in, want := range cases {
+		if got := webSocketURL(in); got != want {
+			t.Errorf("webSocketURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package redaction
+
+import "strings"
+
+// Finding is one entry of the rule list returned by the Sanitize functions,
+// split into its parts: "json:user.password" is {Location: "json", Path:
+// "user.password", Rule: "denylist"} and "header:X-Trace(jwt)" is {Location:
+// "header", Path: "X-Trace", Rule: "jwt"}.
+type Finding struct {
+	Location string `json:"location,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Rule     string `json:"rule"`
+}
+
+// RuleDenylist names findings produced by a header or JSON key denylist.
+const RuleDenylist = "denylist"
+
+// ParseFinding splits a rule note into a Finding. Notes that are not a
+// redaction, such as "resp_body_decode_failed", come back with only Rule set.
+func ParseFinding(note string) Finding {
+	location, rest, ok := strings.Cut(note, ":")
+	if !ok {
+		return Finding{Rule: note}
+	}
+	if location == "text" {
+		return Finding{Location: location, Rule: rest}
+	}
+	if strings.HasSuffix(rest, ")") {
+		if i := strings.LastIndexByte(rest, '('); i >= 0 {
+			return Finding{Location: location, Path: rest[:i], Rule: rest[i+1 : len(rest)-1]}
+		}
+	}
+	if strings.HasSuffix(rest, "_parse_failed_dropped") {
+		return Finding{Location: location, Rule: rest}
+	}
+	return Finding{Location: location, Path: rest, Rule: RuleDenylist}
+}
@@ -1,11 +1,14 @@
 package redaction
 
+import "strings"
+
 // Header name that should be redacted.
 type HeaderRule struct {
 	Name string
 }
 
-// JSON object key that should be redacted.
+// JSON object key that should be redacted. The same names are redacted in
+// query strings, form and multipart fields, and as XML element names.
 type JSONKeyRule struct {
 	Key string
 }
@@ -14,6 +17,24 @@ type JSONKeyRule struct {
 type Policy struct {
 	HeaderDenylist  []HeaderRule
 	JSONKeyDenylist []JSONKeyRule
+	ValueRules      []ValueRule
+
+	// TokenKey, when set, switches placeholders from "[REDACTED]" to
+	// "[REDACTED:<hmac>]" so equal values stay recognisably equal.
+	TokenKey []byte
+
+	// Collect, when set, is called with every placeholder and the original
+	// value it replaced.
+	Collect func(placeholder, original string)
+}
+
+// deniedKeys returns the key denylist lower-cased, for case-insensitive lookup.
+func (p Policy) deniedKeys() map[string]struct{} {
+	deny := make(map[string]struct{}, len(p.JSONKeyDenylist))
+	for _, rule := range p.JSONKeyDenylist {
+		deny[strings.ToLower(rule.Key)] = struct{}{}
+	}
+	return deny
 }
 
 // Default policy used by the backend.
@@ -28,5 +49,16 @@ var DefaultPolicy = Policy{
 		{Key: "password"},
 		{Key: "token"},
 		{Key: "secret"},
+		{Key: "client_secret"},
 	},
 }
+
+// DefaultValueRules are the built-in detectors a project can turn on as a
+// group. They are off by default, so existing projects keep redacting what
+// they did.
+var DefaultValueRules = []ValueRule{
+	{Name: DetectorJWT, Detector: DetectorJWT},
+	{Name: DetectorBearerToken, Detector: DetectorBearerToken},
+	{Name: DetectorCreditCard, Detector: DetectorCreditCard},
+	{Name: DetectorAWSKey, Detector: DetectorAWSKey},
+}
@@ -0,0 +1,120 @@
+package redaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// A placeholder as it appears in a query-escaped URL.
+var escapedPlaceholderRe = regexp.MustCompile(`%5BREDACTED(?:%3A[0-9a-f]+)?%5D`)
+
+// Marks an original that was a JSON number, bool, null, object or array rather
+// than a string.
+const rawJSONPrefix = "\x00json:"
+
+// RawJSONValue marks raw as a JSON token, to be restored unquoted into JSON
+// bodies and as its text anywhere else.
+func RawJSONValue(raw string) string {
+	return rawJSONPrefix + raw
+}
+
+// rawJSON returns the token of a value marked by RawJSONValue.
+func rawJSON(v string) (string, bool) {
+	if !strings.HasPrefix(v, rawJSONPrefix) {
+		return "", false
+	}
+	return v[len(rawJSONPrefix):], true
+}
+
+// textValue is the text a resolved value is substituted as outside JSON.
+func textValue(v string) string {
+	if raw, ok := rawJSON(v); ok {
+		return raw
+	}
+	return v
+}
+
+// ReplacePlaceholders calls resolve for every placeholder in s and substitutes
+// the values it returns. Placeholders it can't resolve are left in place.
+func ReplacePlaceholders(s string, resolve func(placeholder string) (string, bool)) string {
+	if !strings.Contains(s, "[REDACTED") {
+		return s
+	}
+	return placeholderRe.ReplaceAllStringFunc(s, func(ph string) string {
+		if v, ok := resolve(ph); ok {
+			return textValue(v)
+		}
+		return ph
+	})
+}
+
+// RestoreURL substitutes placeholders in the query-escaped query of a URL.
+func RestoreURL(raw string, resolve func(placeholder string) (string, bool)) string {
+	return escapedPlaceholderRe.ReplaceAllStringFunc(raw, func(escaped string) string {
+		ph, err := url.QueryUnescape(escaped)
+		if err != nil {
+			return escaped
+		}
+		if v, ok := resolve(ph); ok {
+			return url.QueryEscape(textValue(v))
+		}
+		return escaped
+	})
+}
+
+// RestoreBody substitutes placeholders in a stored body. JSON bodies are
+// rewritten leaf by leaf so substituted values are escaped properly, and
+// values that weren't strings come back with their JSON type; in form-encoded
+// bodies the placeholders are query-escaped like the values.
+func RestoreBody(body string, resolve func(placeholder string) (string, bool)) string {
+	if !strings.Contains(body, "[REDACTED") && !strings.Contains(body, "%5BREDACTED") {
+		return body
+	}
+
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var root any
+	if err := dec.Decode(&root); err != nil {
+		return ReplacePlaceholders(RestoreURL(body, resolve), resolve)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(restoreJSON(root, resolve)); err != nil {
+		return body
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func restoreJSON(v any, resolve func(placeholder string) (string, bool)) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			t[k] = restoreJSON(child, resolve)
+		}
+		return t
+	case []any:
+		for i, child := range t {
+			t[i] = restoreJSON(child, resolve)
+		}
+		return t
+	case string:
+		// A whole-value placeholder may stand for a non-string value.
+		if IsPlaceholder(t) {
+			v, ok := resolve(t)
+			if !ok {
+				return t
+			}
+			if raw, ok := rawJSON(v); ok && json.Valid([]byte(raw)) {
+				return json.RawMessage(raw)
+			}
+			return textValue(v)
+		}
+		return ReplacePlaceholders(t, resolve)
+	}
+	return v
+}
@@ -0,0 +1,90 @@
+package redaction
+
+import (
+	"testing"
+)
+
+// redactAndResolve sanitizes body with a tokenizing policy and returns the
+// sanitized body and a resolver over the originals it collected.
+func redactAndResolve(t *testing.T, body string, keys ...string) (string, func(string) (string, bool)) {
+	t.Helper()
+	originals := make(map[string]string)
+	policy := Policy{
+		TokenKey: []byte("k"),
+		Collect:  func(ph, original string) { originals[ph] = original },
+	}
+	for _, k := range keys {
+		policy.JSONKeyDenylist = append(policy.JSONKeyDenylist, JSONKeyRule{Key: k})
+	}
+	out, _, err := SanitizeJSON([]byte(body), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), func(ph string) (string, bool) {
+		v, ok := originals[ph]
+		return v, ok
+	}
+}
+
+func TestRestoreBodyKeepsJSONTypes(t *testing.T) {
+	cases := []string{
+		`{"secret":"s3cret"}`,
+		`{"secret":12345678901234567890}`,
+		`{"secret":1.5e-7}`,
+		`{"secret":true}`,
+		`{"secret":null}`,
+		`{"secret":{"a":[1,"two",false]}}`,
+		`{"list":[{"secret":42},{"secret":"42"}]}`,
+	}
+	for _, body := range cases {
+		redacted, resolve := redactAndResolve(t, body, "secret")
+		if redacted == body {
+			t.Fatalf("%s was not redacted", body)
+		}
+		if got := RestoreBody(redacted, resolve); got != body {
+			t.Errorf("RestoreBody(%s) = %s, want %s", redacted, got, body)
+		}
+	}
+}
+
+func TestRestoreBodyStringAndNumberDiffer(t *testing.T) {
+	redacted, _ := redactAndResolve(t, `{"a":{"secret":42},"b":{"secret":"42"}}`, "secret")
+	num, str := Tokenize(RawJSONValue("42"), []byte("k")), Tokenize("42", []byte("k"))
+	if want := `{"a":{"secret":"` + num + `"},"b":{"secret":"` + str + `"}}`; redacted != want {
+		t.Errorf("redacted = %s, want %s", redacted, want)
+	}
+}
+
+func TestRestoreBodyInsideStrings(t *testing.T) {
+	ph := Tokenize("abc", []byte("k"))
+	resolve := func(p string) (string, bool) { return "a\"b", p == ph }
+	body := `{"auth":"Bearer ` + ph + `","other":"[REDACTED:000000000000]"}`
+	want := `{"auth":"Bearer a\"b","other":"[REDACTED:000000000000]"}`
+	if got := RestoreBody(body, resolve); got != want {
+		t.Errorf("RestoreBody = %s, want %s", got, want)
+	}
+}
+
+func TestRestoreNonJSON(t *testing.T) {
+	str := Tokenize("a b&c", []byte("k"))
+	num := Tokenize(RawJSONValue("42"), []byte("k"))
+	values := map[string]string{str: "a b&c", num: RawJSONValue("42")}
+	resolve := func(ph string) (string, bool) {
+		v, ok := values[ph]
+		return v, ok
+	}
+
+	if got := ReplacePlaceholders("x="+str+" n="+num, resolve); got != "x=a b&c n=42" {
+		t.Errorf("ReplacePlaceholders = %q", got)
+	}
+
+	form := "x=%5BREDACTED%3A" + str[len("[REDACTED:"):len(str)-1] + "%5D&n=" + num
+	if got, want := RestoreBody(form, resolve), "x=a+b%26c&n=42"; got != want {
+		t.Errorf("RestoreBody(form) = %q, want %q", got, want)
+	}
+
+	raw := "/users?id=%5BREDACTED%3Affffffffffff%5D"
+	if got := RestoreURL(raw, resolve); got != raw {
+		t.Errorf("RestoreURL with an unknown placeholder = %q", got)
+	}
+}
@@ -3,6 +3,7 @@ package redaction
 import (
 	"fmt"
 	"net/http"
+	"sort"
 )
 
 // SanitizeHeaders creates a deep copy of the input headers, applies the provided Policy,
@@ -20,18 +21,62 @@ func SanitizeHeaders(h http.Header, policy Policy) (http.Header, []string) {
 
 	var appliedRules []string
 
+	denied := make(map[string]struct{}, len(policy.HeaderDenylist))
 	for _, rule := range policy.HeaderDenylist {
 		headerName := rule.Name
 
 		canonicalName := http.CanonicalHeaderKey(headerName)
+		denied[canonicalName] = struct{}{}
 
 		if values, ok := sanitized[canonicalName]; ok {
-			for i := range values {
-				sanitized[canonicalName][i] = "[REDACTED]"
+			for i, v := range values {
+				sanitized[canonicalName][i] = policy.redactHeaderValue(v)
 			}
 			appliedRules = append(appliedRules, fmt.Sprintf("header:%s", canonicalName))
 		}
 	}
 
+	if len(policy.ValueRules) > 0 {
+		names := make([]string, 0, len(sanitized))
+		for k := range sanitized {
+			if _, ok := denied[k]; !ok {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			for i, v := range sanitized[k] {
+				out, matched := SanitizeText(v, policy)
+				if len(matched) == 0 {
+					continue
+				}
+				sanitized[k][i] = out
+				for _, name := range matched {
+					appliedRules = append(appliedRules, fmt.Sprintf("header:%s(%s)", k, name))
+				}
+			}
+		}
+	}
+
 	return sanitized, appliedRules
 }
+
+// redactHeaderValue replaces a denylisted header value. Tokenized placeholders
+// keep an authorization scheme in front ("Bearer [REDACTED:…]") so the token
+// matches the same credential seen without the scheme, e.g. in a login response.
+func (p Policy) redactHeaderValue(v string) string {
+	// Already redacted, e.g. when a stored event is sanitized again.
+	if IsPlaceholder(v) {
+		return v
+	}
+	if prefix, credential, ok := SplitScheme(v); ok && IsPlaceholder(credential) {
+		return prefix + credential
+	}
+	if len(p.TokenKey) > 0 {
+		if prefix, credential, ok := SplitScheme(v); ok {
+			return prefix + p.placeholder(credential)
+		}
+	}
+	return p.placeholder(v)
+}
@@ -0,0 +1,188 @@
+package redaction
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Encodings of a body returned by SanitizeBody.
+const (
+	BodyEncodingText   = "text"
+	BodyEncodingBase64 = "base64"
+)
+
+// SanitizeBody is the redaction applied to a captured request or response
+// body before it is stored. JSON, form-encoded, multipart/form-data and XML
+// bodies are redacted structurally, other text with the value rules, and
+// binary bodies are returned base64-encoded as they are. Bodies that fail to
+// parse as their declared type are dropped and noted under direction ("req"
+// or "resp").
+func SanitizeBody(contentType string, body []byte, direction string, policy Policy) (sanitized, encoding string, applied []string) {
+	if len(body) == 0 {
+		return "", "", nil
+	}
+
+	mediaType, params := parseMediaType(contentType)
+	kind := bodyKind(mediaType)
+	if kind == "" {
+		if !isText(mediaType, body) {
+			return base64.StdEncoding.EncodeToString(body), BodyEncodingBase64, nil
+		}
+		kind = "text"
+	}
+
+	var err error
+	switch kind {
+	case "json":
+		var out []byte
+		out, applied, err = SanitizeJSON(body, policy)
+		sanitized = string(out)
+	case "form":
+		sanitized, applied = SanitizeForm(string(body), policy)
+	case "multipart":
+		sanitized, applied, err = SanitizeMultipart(body, params["boundary"], policy)
+	case "xml":
+		sanitized, applied, err = SanitizeXML(body, policy)
+	case "text":
+		var matched []string
+		sanitized, matched = SanitizeText(string(body), policy)
+		for _, name := range matched {
+			applied = append(applied, "text:"+name)
+		}
+	}
+	if err != nil {
+		return "", "", []string{fmt.Sprintf("%s:%s_body_parse_failed_dropped", kind, direction)}
+	}
+
+	return sanitized, BodyEncodingText, applied
+}
+
+// SanitizeTruncatedBody is SanitizeBody for the first bytes of a longer body.
+// Form bodies are cut after their last complete field and text after its last
+// whitespace, so that no value cut in half escapes the rules that would have
+// matched it whole; binary prefixes are kept as they are. JSON, multipart and
+// XML can't be redacted without the rest of the document, so their prefixes
+// are dropped.
+func SanitizeTruncatedBody(contentType string, prefix []byte, direction string, policy Policy) (sanitized, encoding string, applied []string) {
+	if len(prefix) == 0 {
+		return "", "", nil
+	}
+
+	mediaType, _ := parseMediaType(contentType)
+	kind := bodyKind(mediaType)
+	text := trimPartialRune(prefix)
+	if kind == "" {
+		if !isText(mediaType, text) {
+			return base64.StdEncoding.EncodeToString(prefix), BodyEncodingBase64, nil
+		}
+		kind = "text"
+	}
+
+	switch kind {
+	case "form":
+		if i := bytes.LastIndexByte(text, '&'); i >= 0 {
+			sanitized, applied = SanitizeForm(string(text[:i]), policy)
+			return sanitized, BodyEncodingText, applied
+		}
+	case "text":
+		if i := bytes.LastIndexFunc(text, unicode.IsSpace); i >= 0 {
+			var matched []string
+			sanitized, matched = SanitizeText(string(text[:i+1]), policy)
+			for _, name := range matched {
+				applied = append(applied, "text:"+name)
+			}
+			return sanitized, BodyEncodingText, applied
+		}
+	}
+	return "", "", []string{fmt.Sprintf("%s:%s_body_truncated_dropped", kind, direction)}
+}
+
+// trimPartialRune drops a UTF-8 sequence cut off at the end of b.
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// Media types outside text/* whose bodies are text.
+var textMediaTypes = map[string]struct{}{
+	"application/javascript": {},
+	"application/ecmascript": {},
+	"application/graphql":    {},
+	"application/x-ndjson":   {},
+	"application/x-yaml":     {},
+	"application/yaml":       {},
+	"application/csv":        {},
+	"application/sql":        {},
+	"application/x-sh":       {},
+}
+
+// isText reports whether a body without a structured handler can be stored as
+// text. Untyped bodies are sniffed; typed ones must also be valid UTF-8 so that
+// they survive storage byte for byte.
+func isText(mediaType string, body []byte) bool {
+	if !utf8.Valid(body) {
+		return false
+	}
+	if mediaType == "" {
+		return !bytes.ContainsFunc(body, func(r rune) bool {
+			return r < 0x20 && r != '\t' && r != '\n' && r != '\r'
+		})
+	}
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+yaml") {
+		return true
+	}
+	_, ok := textMediaTypes[mediaType]
+	return ok
+}
+
+// bodyKind names the redaction handler for a media type, or returns "" when
+// there is none.
+func bodyKind(mediaType string) string {
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "application/x-www-form-urlencoded":
+		return "form"
+	case mediaType == "multipart/form-data":
+		return "multipart"
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return "xml"
+	}
+	return ""
+}
+
+// IsJSONContentType reports whether contentType is application/json or a
+// +json media type.
+func IsJSONContentType(contentType string) bool {
+	mediaType, _ := parseMediaType(contentType)
+	return bodyKind(mediaType) == "json"
+}
+
+// parseMediaType returns the lower-cased media type and its parameters.
+func parseMediaType(contentType string) (string, map[string]string) {
+	trimmed := strings.TrimSpace(contentType)
+	if trimmed == "" {
+		return "", nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(trimmed)
+	if err != nil {
+		// Fall back to best-effort parse for non-compliant values.
+		parts := strings.SplitN(trimmed, ";", 2)
+		mediaType = strings.TrimSpace(parts[0])
+	}
+
+	return strings.ToLower(mediaType), params
+}
@@ -0,0 +1,101 @@
+package redaction
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeTruncatedBody(t *testing.T) {
+	policy := Policy{
+		JSONKeyDenylist: []JSONKeyRule{{Key: "password"}},
+		ValueRules:      []ValueRule{{Name: DetectorBearerToken, Detector: DetectorBearerToken}},
+	}
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0x10}
+	cases := []struct {
+		name, contentType, prefix string
+		sanitized, encoding       string
+		applied                   []string
+	}{
+		{
+			name:        "form cut after the last complete field",
+			contentType: "application/x-www-form-urlencoded",
+			prefix:      "a=1&password=hunter2&b=partial-val",
+			sanitized:   "a=1&password=%5BREDACTED%5D",
+			encoding:    BodyEncodingText,
+			applied:     []string{"form:password"},
+		},
+		{
+			name:        "form without a complete field",
+			contentType: "application/x-www-form-urlencoded",
+			prefix:      "password=hunt",
+			applied:     []string{"form:req_body_truncated_dropped"},
+		},
+		{
+			name:        "text cut after the last whitespace",
+			contentType: "text/plain",
+			prefix:      "auth: Bearer abcdefgh12345678 and Bearer abcdefg",
+			sanitized:   "auth: Bearer [REDACTED] and Bearer ",
+			encoding:    BodyEncodingText,
+			applied:     []string{"text:" + DetectorBearerToken},
+		},
+		{
+			name:        "text without whitespace",
+			contentType: "text/plain",
+			prefix:      "Bearerabcdefgh12345678",
+			applied:     []string{"text:req_body_truncated_dropped"},
+		},
+		{
+			name:        "partial rune at the cut",
+			contentType: "text/plain; charset=utf-8",
+			prefix:      "café crème"[:len("café crème")-1],
+			sanitized:   "café ",
+			encoding:    BodyEncodingText,
+		},
+		{
+			name:        "json",
+			contentType: "application/json",
+			prefix:      `{"password":"hunter2","b":`,
+			applied:     []string{"json:req_body_truncated_dropped"},
+		},
+		{
+			name:        "xml",
+			contentType: "application/xml",
+			prefix:      "<a><password>x</password><b>",
+			applied:     []string{"xml:req_body_truncated_dropped"},
+		},
+		{
+			name:        "binary kept as is",
+			contentType: "image/png",
+			prefix:      string(binary),
+			sanitized:   base64.StdEncoding.EncodeToString(binary),
+			encoding:    BodyEncodingBase64,
+		},
+		{
+			name:        "empty",
+			contentType: "text/plain",
+		},
+	}
+	for _, c := range cases {
+		sanitized, encoding, applied := SanitizeTruncatedBody(c.contentType, []byte(c.prefix), "req", policy)
+		if sanitized != c.sanitized || encoding != c.encoding || !reflect.DeepEqual(applied, c.applied) {
+			t.Errorf("%s: got %q, %q, %v; want %q, %q, %v",
+				c.name, sanitized, encoding, applied, c.sanitized, c.encoding, c.applied)
+		}
+	}
+}
+
+func TestTrimPartialRune(t *testing.T) {
+	full := []byte("a€") // the euro sign is three bytes
+	cases := map[int]string{
+		len(full):     "a€",
+		len(full) - 1: "a",
+		len(full) - 2: "a",
+		1:             "a",
+	}
+	for n, want := range cases {
+		if got := string(trimPartialRune(full[:n])); got != want {
+			t.Errorf("trimPartialRune(%q) = %q, want %q", full[:n], got, want)
+		}
+	}
+}
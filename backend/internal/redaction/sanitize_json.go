@@ -1,26 +1,45 @@
 package redaction
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 )
 
 const redactedValue = "[REDACTED]"
 
-func SanitizeJSON(body []byte) (sanitized []byte, applied []string, err error) {
+// leafOriginal is what a JSON value under a denied key is tokenized from and
+// kept as: strings as-is, any other value as its raw JSON token, so restoring
+// it brings back a number, bool or object rather than a string.
+func leafOriginal(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return RawJSONValue(string(b))
+}
+
+// SanitizeJSON replaces the values of keys in the policy's JSON key denylist,
+// at any depth, applies value rules to string and number leaves, and returns
+// the re-encoded body with the paths it redacted.
+func SanitizeJSON(body []byte, policy Policy) (sanitized []byte, applied []string, err error) {
+	// Numbers are kept verbatim so long digit strings such as card numbers are
+	// neither rounded nor missed by value rules.
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
 	var root any
-	if err := json.Unmarshal(body, &root); err != nil {
+	if err := dec.Decode(&root); err != nil {
 		return nil, nil, fmt.Errorf("parse json: %w", err)
 	}
-
-	deny := make(map[string]struct{}, len(DefaultPolicy.JSONKeyDenylist))
-	for _, rule := range DefaultPolicy.JSONKeyDenylist {
-		deny[strings.ToLower(rule.Key)] = struct{}{}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, fmt.Errorf("parse json: unexpected data after top-level value")
 	}
 
-	sanitizedRoot := sanitizeJSONNode(root, "", deny, &applied)
+	sanitizedRoot := sanitizeJSONNode(root, "", policy.deniedKeys(), policy, &applied)
 
 	out, err := json.Marshal(sanitizedRoot)
 	if err != nil {
@@ -30,7 +49,7 @@ func SanitizeJSON(body []byte) (sanitized []byte, applied []string, err error) {
 	return out, applied, nil
 }
 
-func sanitizeJSONNode(v any, path string, deny map[string]struct{}, applied *[]string) any {
+func sanitizeJSONNode(v any, path string, deny map[string]struct{}, policy Policy, applied *[]string) any {
 	switch t := v.(type) {
 	case map[string]any:
 		keys := make([]string, 0, len(t))
@@ -47,19 +66,38 @@ func sanitizeJSONNode(v any, path string, deny map[string]struct{}, applied *[]s
 			}
 
 			if _, denied := deny[strings.ToLower(k)]; denied {
-				out[k] = redactedValue
+				if s, ok := t[k].(string); ok && IsPlaceholder(s) {
+					out[k] = s
+				} else {
+					out[k] = policy.placeholder(leafOriginal(t[k]))
+				}
 				*applied = append(*applied, "json:"+childPath)
 				continue
 			}
 
-			out[k] = sanitizeJSONNode(t[k], childPath, deny, applied)
+			out[k] = sanitizeJSONNode(t[k], childPath, deny, policy, applied)
 		}
 		return out
 	case []any:
 		out := make([]any, len(t))
 		for i := range t {
 			childPath := fmt.Sprintf("%s[%d]", path, i)
-			out[i] = sanitizeJSONNode(t[i], childPath, deny, applied)
+			out[i] = sanitizeJSONNode(t[i], childPath, deny, policy, applied)
+		}
+		return out
+	case string:
+		out, matched := SanitizeText(t, policy)
+		for _, name := range matched {
+			*applied = append(*applied, fmt.Sprintf("json:%s(%s)", path, name))
+		}
+		return out
+	case json.Number:
+		out, matched := SanitizeText(t.String(), policy)
+		if len(matched) == 0 {
+			return t
+		}
+		for _, name := range matched {
+			*applied = append(*applied, fmt.Sprintf("json:%s(%s)", path, name))
 		}
 		return out
 	default:
@@ -0,0 +1,107 @@
+package redaction
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+)
+
+// SanitizeMultipart redacts a multipart/form-data body part by part and
+// re-encodes it with the same boundary. Fields named in the key denylist are
+// redacted entirely, JSON fields structurally and other fields with the value
+// rules. File contents are replaced with a one-line summary.
+func SanitizeMultipart(body []byte, boundary string, policy Policy) (string, []string, error) {
+	if boundary == "" {
+		return "", nil, errors.New("parse multipart: missing boundary")
+	}
+
+	deny := policy.deniedKeys()
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.SetBoundary(boundary); err != nil {
+		return "", nil, fmt.Errorf("parse multipart: %w", err)
+	}
+
+	var applied []string
+	for {
+		part, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("parse multipart: %w", err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return "", nil, fmt.Errorf("parse multipart: %w", err)
+		}
+
+		value, notes := sanitizeMultipartPart(part, data, deny, policy)
+		for _, note := range notes {
+			applied = append(applied, "multipart:"+note)
+		}
+
+		pw, err := w.CreatePart(part.Header)
+		if err != nil {
+			return "", nil, fmt.Errorf("write multipart: %w", err)
+		}
+		if _, err := io.WriteString(pw, value); err != nil {
+			return "", nil, fmt.Errorf("write multipart: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, fmt.Errorf("write multipart: %w", err)
+	}
+
+	return buf.String(), applied, nil
+}
+
+// sanitizeMultipartPart returns the stored content of one part and the notes
+// for it, without the "multipart:" prefix.
+func sanitizeMultipartPart(part *multipart.Part, data []byte, deny map[string]struct{}, policy Policy) (string, []string) {
+	name := part.FormName()
+
+	if filename := part.FileName(); filename != "" {
+		summary := fmt.Sprintf("[FILE name=%q type=%q size=%d]", filename, part.Header.Get("Content-Type"), len(data))
+		if strings.HasPrefix(string(data), "[FILE ") {
+			// Already summarized, e.g. when a stored event is sanitized again.
+			summary = string(data)
+		}
+		return summary, []string{fmt.Sprintf("%s(file_summarized)", name)}
+	}
+
+	if _, denied := deny[strings.ToLower(name)]; denied && name != "" {
+		value := string(data)
+		if !IsPlaceholder(value) {
+			value = policy.placeholder(value)
+		}
+		return value, []string{name}
+	}
+
+	if IsJSONContentType(part.Header.Get("Content-Type")) {
+		if sanitized, jsonNotes, err := SanitizeJSON(data, policy); err == nil {
+			notes := make([]string, 0, len(jsonNotes))
+			for _, note := range jsonNotes {
+				path := strings.TrimPrefix(note, "json:")
+				if strings.HasPrefix(path, "[") || strings.HasPrefix(path, "(") {
+					notes = append(notes, name+path)
+				} else {
+					notes = append(notes, name+"."+path)
+				}
+			}
+			return string(sanitized), notes
+		}
+	}
+
+	value, matched := SanitizeText(string(data), policy)
+	notes := make([]string, 0, len(matched))
+	for _, rule := range matched {
+		notes = append(notes, fmt.Sprintf("%s(%s)", name, rule))
+	}
+	return value, notes
+}
@@ -0,0 +1,68 @@
+package redaction
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SanitizeURL redacts the query of a URL or request URI: parameters named in
+// the policy's key denylist entirely, and value rule matches in the others.
+// Parameter order and untouched values are preserved as sent.
+func SanitizeURL(rawURL string, policy Policy) (string, []string) {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok || query == "" {
+		return rawURL, nil
+	}
+	query, applied := sanitizeQuery(query, "query", policy)
+	return base + "?" + query, applied
+}
+
+// SanitizeForm redacts an application/x-www-form-urlencoded body the same way
+// SanitizeURL redacts a query.
+func SanitizeForm(body string, policy Policy) (string, []string) {
+	return sanitizeQuery(body, "form", policy)
+}
+
+func sanitizeQuery(query, location string, policy Policy) (string, []string) {
+	deny := policy.deniedKeys()
+	if len(deny) == 0 && len(policy.ValueRules) == 0 {
+		return query, nil
+	}
+
+	var applied []string
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		name, value, hasValue := strings.Cut(pair, "=")
+		if !hasValue {
+			continue
+		}
+		key, err := url.QueryUnescape(name)
+		if err != nil {
+			key = name
+		}
+		decoded, err := url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+
+		if _, denied := deny[strings.ToLower(key)]; denied {
+			if !IsPlaceholder(decoded) {
+				pairs[i] = name + "=" + url.QueryEscape(policy.placeholder(decoded))
+			}
+			applied = append(applied, fmt.Sprintf("%s:%s", location, key))
+			continue
+		}
+
+		out, matched := SanitizeText(decoded, policy)
+		if len(matched) == 0 {
+			continue
+		}
+		pairs[i] = name + "=" + url.QueryEscape(out)
+		for _, rule := range matched {
+			applied = append(applied, fmt.Sprintf("%s:%s(%s)", location, key, rule))
+		}
+	}
+
+	return strings.Join(pairs, "&"), applied
+}
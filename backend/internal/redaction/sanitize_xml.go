@@ -0,0 +1,96 @@
+package redaction
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// SanitizeXML redacts an XML or SOAP body. The content of elements whose local
+// name is in the key denylist is replaced entirely, and value rules are applied
+// to other text. Edits are spliced into the original bytes, so formatting,
+// namespaces and everything else outside the redacted values are kept as sent.
+// Paths are the dotted local names of the enclosing elements
+// ("Envelope.Body.Login.Password").
+func SanitizeXML(body []byte, policy Policy) (string, []string, error) {
+	type edit struct {
+		start, end int64
+		value      string
+	}
+
+	deny := policy.deniedKeys()
+	d := xml.NewDecoder(bytes.NewReader(body))
+	// Values are spliced as raw bytes, so the declared charset doesn't matter.
+	d.CharsetReader = func(_ string, in io.Reader) (io.Reader, error) { return in, nil }
+
+	var (
+		applied      []string
+		edits        []edit
+		stack        []string
+		deniedDepth  int
+		contentStart int64
+	)
+	for {
+		start := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("parse xml: %w", err)
+		}
+		end := d.InputOffset()
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if _, denied := deny[strings.ToLower(t.Name.Local)]; denied && deniedDepth == 0 {
+				deniedDepth = len(stack)
+				contentStart = end
+			}
+		case xml.EndElement:
+			if deniedDepth == len(stack) {
+				// Redact the element's content without its surrounding whitespace.
+				inner := string(body[contentStart:start])
+				trimmed := strings.TrimFunc(inner, unicode.IsSpace)
+				if trimmed != "" {
+					if !IsPlaceholder(trimmed) {
+						from := contentStart + int64(strings.Index(inner, trimmed))
+						edits = append(edits, edit{from, from + int64(len(trimmed)), policy.placeholder(trimmed)})
+					}
+					applied = append(applied, "xml:"+strings.Join(stack, "."))
+				}
+				deniedDepth = 0
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if deniedDepth != 0 || len(stack) == 0 {
+				continue
+			}
+			out, matched := SanitizeText(string(body[start:end]), policy)
+			if len(matched) == 0 {
+				continue
+			}
+			edits = append(edits, edit{start, end, out})
+			for _, rule := range matched {
+				applied = append(applied, fmt.Sprintf("xml:%s(%s)", strings.Join(stack, "."), rule))
+			}
+		}
+	}
+
+	if len(edits) == 0 {
+		return string(body), applied, nil
+	}
+	var b strings.Builder
+	last := int64(0)
+	for _, e := range edits {
+		b.Write(body[last:e.start])
+		b.WriteString(e.value)
+		last = e.end
+	}
+	b.Write(body[last:])
+	return b.String(), applied, nil
+}
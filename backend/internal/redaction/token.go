@@ -0,0 +1,67 @@
+package redaction
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// Hex digits of the HMAC kept in a tokenized placeholder.
+const tokenHexLen = 12
+
+var (
+	placeholderRe = regexp.MustCompile(`\[REDACTED(?::[0-9a-f]+)?\]`)
+	// An authorization-style value: a scheme followed by a single credential.
+	schemeValueRe = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*)(\s+)(\S+)$`)
+)
+
+// placeholder is what replaces value. Without a token key every value becomes
+// "[REDACTED]"; with one, the placeholder carries a keyed hash of the value so
+// identical secrets map to identical placeholders.
+func (p Policy) placeholder(value string) string {
+	ph := redactedValue
+	if len(p.TokenKey) > 0 {
+		ph = Tokenize(value, p.TokenKey)
+	}
+	if p.Collect != nil {
+		p.Collect(ph, value)
+	}
+	return ph
+}
+
+// Tokenize returns the stable placeholder for value under key.
+func Tokenize(value string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return "[REDACTED:" + hex.EncodeToString(mac.Sum(nil))[:tokenHexLen] + "]"
+}
+
+// IsPlaceholder reports whether s is exactly a redaction placeholder, plain or
+// tokenized.
+func IsPlaceholder(s string) bool {
+	loc := placeholderRe.FindStringIndex(s)
+	return loc != nil && loc[0] == 0 && loc[1] == len(s)
+}
+
+// ContainsPlaceholder reports whether any part of s was redacted.
+func ContainsPlaceholder(s string) bool {
+	return strings.Contains(s, "[REDACTED") && placeholderRe.MatchString(s)
+}
+
+// IsTokenized reports whether s is a tokenized placeholder, which identifies a
+// single original value.
+func IsTokenized(s string) bool {
+	return IsPlaceholder(s) && s != redactedValue
+}
+
+// SplitScheme splits an authorization-style value ("Bearer abc") into its
+// scheme prefix, including the separating whitespace, and credential.
+func SplitScheme(value string) (prefix, credential string, ok bool) {
+	m := schemeValueRe.FindStringSubmatch(value)
+	if m == nil {
+		return "", value, false
+	}
+	return m[1] + m[2], m[3], true
+}
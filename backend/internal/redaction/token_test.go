@@ -0,0 +1,100 @@
+package redaction
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+var tokenizedRe = regexp.MustCompile(`^\[REDACTED:[0-9a-f]{12}\]$`)
+
+func TestTokenize(t *testing.T) {
+	a := Tokenize("s3cret", []byte("key-a"))
+	if !tokenizedRe.MatchString(a) {
+		t.Fatalf("Tokenize = %q, want [REDACTED:<12 hex>]", a)
+	}
+	if b := Tokenize("s3cret", []byte("key-a")); b != a {
+		t.Errorf("same value and key gave %q and %q", a, b)
+	}
+	if b := Tokenize("s3cret", []byte("key-b")); b == a {
+		t.Errorf("different keys gave the same placeholder %q", a)
+	}
+	if b := Tokenize("other", []byte("key-a")); b == a {
+		t.Errorf("different values gave the same placeholder %q", a)
+	}
+}
+
+func TestPlaceholderPredicates(t *testing.T) {
+	tok := Tokenize("v", []byte("k"))
+	cases := []struct {
+		s                           string
+		placeholder, tokenized, has bool
+	}{
+		{redactedValue, true, false, true},
+		{tok, true, true, true},
+		{"Bearer " + tok, false, false, true},
+		{"[REDACTED:xyz]", false, false, false},
+		{"plain", false, false, false},
+	}
+	for _, c := range cases {
+		if got := IsPlaceholder(c.s); got != c.placeholder {
+			t.Errorf("IsPlaceholder(%q) = %v", c.s, got)
+		}
+		if got := IsTokenized(c.s); got != c.tokenized {
+			t.Errorf("IsTokenized(%q) = %v", c.s, got)
+		}
+		if got := ContainsPlaceholder(c.s); got != c.has {
+			t.Errorf("ContainsPlaceholder(%q) = %v", c.s, got)
+		}
+	}
+}
+
+func TestSplitScheme(t *testing.T) {
+	prefix, credential, ok := SplitScheme("Bearer abc.def")
+	if !ok || prefix != "Bearer " || credential != "abc.def" {
+		t.Errorf("SplitScheme = %q, %q, %v", prefix, credential, ok)
+	}
+	if _, credential, ok := SplitScheme("abc def ghi"); ok || credential != "abc def ghi" {
+		t.Errorf("SplitScheme of a multi-word value = %q, %v", credential, ok)
+	}
+}
+
+func TestTokenizedPolicyCollectsOriginals(t *testing.T) {
+	originals := make(map[string]string)
+	policy := Policy{
+		HeaderDenylist:  []HeaderRule{{Name: "Authorization"}},
+		JSONKeyDenylist: []JSONKeyRule{{Key: "token"}},
+		TokenKey:        []byte("k"),
+		Collect:         func(ph, original string) { originals[ph] = original },
+	}
+
+	h, _ := SanitizeHeaders(http.Header{"Authorization": {"Bearer abc123"}}, policy)
+	want := "Bearer " + Tokenize("abc123", policy.TokenKey)
+	if got := h.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+
+	body, _, err := SanitizeJSON([]byte(`{"token":"abc123","nested":{"token":"abc123"}}`), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph := Tokenize("abc123", policy.TokenKey)
+	if wantBody := `{"nested":{"token":"` + ph + `"},"token":"` + ph + `"}`; string(body) != wantBody {
+		t.Errorf("body = %s, want %s", body, wantBody)
+	}
+	if len(originals) != 1 || originals[ph] != "abc123" {
+		t.Errorf("originals = %v", originals)
+	}
+}
+
+func TestUntokenizedPolicy(t *testing.T) {
+	body, _, err := SanitizeJSON([]byte(`{"token":"a","secret":"b"}`), Policy{
+		JSONKeyDenylist: []JSONKeyRule{{Key: "token"}, {Key: "secret"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"secret":"[REDACTED]","token":"[REDACTED]"}`; string(body) != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+}
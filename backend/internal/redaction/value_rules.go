@@ -0,0 +1,208 @@
+package redaction
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Built-in detectors usable as ValueRule.Detector.
+const (
+	DetectorJWT         = "jwt"
+	DetectorBearerToken = "bearer_token"
+	DetectorCreditCard  = "credit_card"
+	DetectorAWSKey      = "aws_key"
+	DetectorEmail       = "email"
+)
+
+// ValueRule redacts matching substrings wherever they appear: header values,
+// JSON string and number leaves, and URL query values. A rule uses either a
+// built-in Detector or a regular expression Pattern.
+type ValueRule struct {
+	Name     string
+	Detector string
+	Pattern  string
+
+	re *regexp.Regexp
+}
+
+type detector struct {
+	re *regexp.Regexp
+	// check, when set, must also accept a match for it to be redacted.
+	check func(match string) bool
+}
+
+var detectors = map[string]detector{
+	DetectorJWT: {
+		re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]*`),
+	},
+	DetectorBearerToken: {
+		re: regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]{8,}=*)`),
+	},
+	DetectorCreditCard: {
+		re:    regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		check: looksLikeCardNumber,
+	},
+	DetectorAWSKey: {
+		re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b|(?i:aws_?secret_?access_?key)["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`),
+	},
+	DetectorEmail: {
+		re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	},
+}
+
+// NewValueRule validates and compiles a rule. Exactly one of detector and
+// pattern must be set; name defaults to the detector name.
+func NewValueRule(name, detectorName, pattern string) (ValueRule, error) {
+	switch {
+	case detectorName != "" && pattern != "":
+		return ValueRule{}, errors.New("set either detector or pattern, not both")
+	case detectorName != "":
+		if _, ok := detectors[detectorName]; !ok {
+			return ValueRule{}, fmt.Errorf("unknown detector %q", detectorName)
+		}
+		if name == "" {
+			name = detectorName
+		}
+		return ValueRule{Name: name, Detector: detectorName}, nil
+	case pattern != "":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return ValueRule{}, fmt.Errorf("invalid pattern: %w", err)
+		}
+		if name == "" {
+			name = "pattern"
+		}
+		return ValueRule{Name: name, Pattern: pattern, re: re}, nil
+	}
+	return ValueRule{}, errors.New("detector or pattern is required")
+}
+
+// redact replaces every match of the rule in s. When the pattern has a group
+// named "secret", only that part of the match is replaced.
+func (r ValueRule) redact(s string, policy Policy) (string, bool) {
+	re, check := r.re, (func(string) bool)(nil)
+	if d, ok := detectors[r.Detector]; ok {
+		re, check = d.re, d.check
+	}
+	if re == nil && r.Pattern != "" {
+		// Rules built without NewValueRule; invalid patterns never match.
+		re, _ = regexp.Compile(r.Pattern)
+	}
+	if re == nil {
+		return s, false
+	}
+
+	secret := re.SubexpIndex("secret")
+	existing := placeholderRe.FindAllStringIndex(s, -1)
+	matched := false
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		if check != nil && !check(s[loc[0]:loc[1]]) {
+			continue
+		}
+		start, end := loc[0], loc[1]
+		if secret >= 0 && loc[2*secret] >= 0 {
+			start, end = loc[2*secret], loc[2*secret+1]
+		}
+		// Placeholders left by an earlier rule are not redacted again.
+		if overlapsAny(start, end, existing) {
+			continue
+		}
+		matched = true
+		b.WriteString(s[last:start])
+		b.WriteString(policy.placeholder(s[start:end]))
+		last = end
+	}
+	if !matched {
+		return s, false
+	}
+	b.WriteString(s[last:])
+	return b.String(), true
+}
+
+func overlapsAny(start, end int, spans [][]int) bool {
+	for _, sp := range spans {
+		if start < sp[1] && sp[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeText applies the policy's value rules to s and returns the names of
+// the rules that matched.
+func SanitizeText(s string, policy Policy) (string, []string) {
+	var applied []string
+	for _, rule := range policy.ValueRules {
+		var matched bool
+		if s, matched = rule.redact(s, policy); matched {
+			applied = append(applied, rule.Name)
+		}
+	}
+	return s, applied
+}
+
+// looksLikeCardNumber reports whether the digits in s start with a known card
+// network prefix and pass the Luhn checksum. Separators are ignored. The prefix
+// check keeps long numeric IDs and millisecond timestamps, a tenth of which pass
+// Luhn by chance, from being redacted.
+func looksLikeCardNumber(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	return hasCardPrefix(digits) && luhnValid(digits)
+}
+
+func hasCardPrefix(digits string) bool {
+	prefix := func(n int) int {
+		v := 0
+		for _, c := range digits[:n] {
+			v = v*10 + int(c-'0')
+		}
+		return v
+	}
+	switch p2, p3, p4 := prefix(2), prefix(3), prefix(4); {
+	case digits[0] == '4': // Visa
+		return true
+	case p2 >= 51 && p2 <= 55, p4 >= 2221 && p4 <= 2720: // Mastercard
+		return true
+	case p2 == 34 || p2 == 37: // American Express
+		return true
+	case p4 == 6011, p2 == 65, p3 >= 644 && p3 <= 649: // Discover
+		return true
+	case p2 == 35: // JCB
+		return true
+	case p2 == 36 || p2 == 38 || p2 == 39 || (p3 >= 300 && p3 <= 305): // Diners Club
+		return true
+	case p2 == 62: // UnionPay
+		return true
+	}
+	return false
+}
+
+func luhnValid(digits string) bool {
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,117 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+// tokenChain maps tokenized placeholders to the live values the target
+// returned in their place during this replay. A token issued by a replayed
+// login is then sent on the later requests that carried the recorded one.
+type tokenChain struct {
+	values map[string]string
+}
+
+func newTokenChain() *tokenChain {
+	return &tokenChain{values: make(map[string]string)}
+}
+
+func (c *tokenChain) resolve(placeholder string) (string, bool) {
+	v, ok := c.values[placeholder]
+	return v, ok
+}
+
+// learn pairs tokenized values in the recorded response with what the target
+// returned at the same header or JSON path.
+func (c *tokenChain) learn(e *models.Event, resp *Response) {
+	var recordedHeaders http.Header
+	if e.RespHeaders != "" {
+		_ = json.Unmarshal([]byte(e.RespHeaders), &recordedHeaders)
+	}
+	for name, values := range recordedHeaders {
+		live := resp.Headers.Values(name)
+		for i, v := range values {
+			if i < len(live) {
+				c.learnValue(v, live[i])
+			}
+		}
+	}
+
+	if e.RespBody == "" || !strings.Contains(e.RespBody, "[REDACTED:") {
+		return
+	}
+	var rec, rep any
+	// Live numbers are kept verbatim, as they may be sent back.
+	dec := json.NewDecoder(bytes.NewReader(resp.Body))
+	dec.UseNumber()
+	if json.Unmarshal([]byte(e.RespBody), &rec) != nil || dec.Decode(&rep) != nil {
+		return
+	}
+	c.learnJSON(rec, rep)
+}
+
+func (c *tokenChain) learnJSON(recorded, replayed any) {
+	switch rec := recorded.(type) {
+	case map[string]any:
+		rep, ok := replayed.(map[string]any)
+		if !ok {
+			return
+		}
+		for k, v := range rec {
+			if repV, ok := rep[k]; ok {
+				c.learnJSON(v, repV)
+			}
+		}
+	case []any:
+		rep, ok := replayed.([]any)
+		if !ok {
+			return
+		}
+		for i := 0; i < len(rec) && i < len(rep); i++ {
+			c.learnJSON(rec[i], rep[i])
+		}
+	case string:
+		switch rep := replayed.(type) {
+		case string:
+			c.learnValue(rec, rep)
+		default:
+			// A redacted number, bool or object is sent back with its type.
+			if redaction.IsTokenized(rec) {
+				if raw, err := json.Marshal(rep); err == nil {
+					c.values[rec] = redaction.RawJSONValue(string(raw))
+				}
+			}
+		}
+	}
+}
+
+func (c *tokenChain) learnValue(recorded, live string) {
+	if redaction.IsTokenized(recorded) {
+		c.values[recorded] = live
+		return
+	}
+	// "Bearer [REDACTED:…]" pairs with the credential after the same scheme.
+	if prefix, credential, ok := redaction.SplitScheme(recorded); ok && redaction.IsTokenized(credential) {
+		if len(live) > len(prefix) && strings.EqualFold(live[:len(prefix)], prefix) {
+			c.values[credential] = live[len(prefix):]
+		}
+	}
+}
+
+// resolveText substitutes every placeholder s knows a live value for.
+func (s *Sender) resolveText(text string) string {
+	return redaction.ReplacePlaceholders(text, s.resolve)
+}
+
+func (s *Sender) resolveURL(raw string) string {
+	return redaction.RestoreURL(raw, s.resolve)
+}
+
+func (s *Sender) resolveBody(body string) string {
+	return redaction.RestoreBody(body, s.resolve)
+}
@@ -0,0 +1,43 @@
+package replay
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+func TestTokenChainLearnsLiveValues(t *testing.T) {
+	key := []byte("k")
+	token := redaction.Tokenize("recorded-token", key)
+	session := redaction.Tokenize("recorded-session", key)
+	userId := redaction.Tokenize(redaction.RawJSONValue("7"), key)
+	flags := redaction.Tokenize(redaction.RawJSONValue(`{"a":true}`), key)
+
+	e := &models.Event{
+		RespHeaders: `{"Set-Cookie":["` + session + `"],"Authorization":["Bearer ` + token + `"]}`,
+		RespBody:    `{"user":{"id":"` + userId + `","flags":"` + flags + `"},"token":"` + token + `"}`,
+	}
+	resp := &Response{
+		Headers: http.Header{
+			"Set-Cookie":    {"live-session"},
+			"Authorization": {"Bearer live-token"},
+		},
+		Body: []byte(`{"user":{"id":12345678901234567890,"flags":{"b":false}},"token":"live-token"}`),
+	}
+
+	c := newTokenChain()
+	c.learn(e, resp)
+	for ph, want := range map[string]string{token: "live-token", session: "live-session"} {
+		if got, ok := c.resolve(ph); !ok || got != want {
+			t.Errorf("resolve(%s) = %q, %v; want %q", ph, got, ok, want)
+		}
+	}
+
+	body := `{"id":"` + userId + `","flags":"` + flags + `","auth":"Bearer ` + token + `"}`
+	want := `{"auth":"Bearer live-token","flags":{"b":false},"id":12345678901234567890}`
+	if got := redaction.RestoreBody(body, c.resolve); got != want {
+		t.Errorf("RestoreBody = %s, want %s", got, want)
+	}
+}
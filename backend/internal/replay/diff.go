@@ -0,0 +1,305 @@
+package replay
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+const maxDiffTextBytes = 512
+
+// Headers that legitimately change between two runs of the same request.
+var volatileHeaders = map[string]struct{}{
+	"Age":            {},
+	"Connection":     {},
+	"Content-Length": {},
+	"Date":           {},
+	"Keep-Alive":     {},
+	// Derived from the per-handshake WebSocket key.
+	"Sec-Websocket-Accept": {},
+	"Transfer-Encoding":    {},
+}
+
+// Diff describes how a replayed response differs from the recorded one.
+type Diff struct {
+	Seq            int          `json:"seq"`
+	EventId        string       `json:"event_id"`
+	Method         string       `json:"method"`
+	URL            string       `json:"url"`
+	RecordedStatus int          `json:"recorded_status"`
+	ReplayedStatus int          `json:"replayed_status"`
+	Headers        []HeaderDiff `json:"headers,omitempty"`
+	Body           []BodyDiff   `json:"body,omitempty"`
+}
+
+type HeaderDiff struct {
+	Name     string   `json:"name"`
+	Recorded []string `json:"recorded,omitempty"`
+	Replayed []string `json:"replayed,omitempty"`
+}
+
+// BodyDiff is a single structural difference. Path uses the same notation as
+// redaction rules ("user.roles[0]"); an empty path refers to the whole body.
+type BodyDiff struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"` // added|removed|changed|type|unknown
+	Recorded any    `json:"recorded,omitempty"`
+	Replayed any    `json:"replayed,omitempty"`
+}
+
+// HasMismatch reports whether the replayed response differs. A body that
+// couldn't be compared ("unknown") is not a mismatch.
+func (d *Diff) HasMismatch() bool {
+	if d.RecordedStatus != d.ReplayedStatus || len(d.Headers) > 0 {
+		return true
+	}
+	for _, b := range d.Body {
+		if b.Kind != "unknown" {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare diffs resp against the recorded event. The replayed response is run
+// through the project's redaction policy first, as captured traffic was, so
+// redacted fields compare equal and secrets never end up in a diff.
+func Compare(e *models.Event, resp *Response, policy redaction.Policy) *Diff {
+	d := &Diff{
+		Seq:            e.Seq,
+		EventId:        e.Id,
+		Method:         e.Method,
+		URL:            e.URL,
+		RecordedStatus: e.Status,
+		ReplayedStatus: resp.Status,
+	}
+
+	var recordedHeaders http.Header
+	if e.RespHeaders != "" {
+		_ = json.Unmarshal([]byte(e.RespHeaders), &recordedHeaders)
+	}
+	replayedHeaders, _ := redaction.SanitizeHeaders(resp.Headers, policy)
+	d.Headers = diffHeaders(recordedHeaders, replayedHeaders)
+
+	if e.RespBodyEncoding == models.BodyEncodingBase64 || e.RespBodyTruncated || resp.BodyTruncated || resp.BodyIncomplete {
+		d.Body = diffBlobs(e, resp)
+	} else {
+		d.Body = diffBodies(e.RespBody, resp.Headers.Get("Content-Type"), resp.Body, policy)
+	}
+	if resp.RecordedFrames != nil {
+		d.Body = append(d.Body, diffFrames(resp.RecordedFrames, resp.Frames, policy)...)
+	}
+	return d
+}
+
+func diffHeaders(recorded, replayed http.Header) []HeaderDiff {
+	names := make(map[string]struct{}, len(recorded)+len(replayed))
+	for k := range recorded {
+		names[http.CanonicalHeaderKey(k)] = struct{}{}
+	}
+	for k := range replayed {
+		names[http.CanonicalHeaderKey(k)] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		if _, volatile := volatileHeaders[k]; volatile {
+			continue
+		}
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var out []HeaderDiff
+	for _, name := range sorted {
+		rec := recorded.Values(name)
+		rep := replayed.Values(name)
+		if reflect.DeepEqual(rec, rep) {
+			continue
+		}
+		out = append(out, HeaderDiff{Name: name, Recorded: rec, Replayed: rep})
+	}
+	return out
+}
+
+func diffBodies(recorded, contentType string, replayed []byte, policy redaction.Policy) []BodyDiff {
+	// Bodies that were not captured at recording time can't be compared.
+	if recorded == "" {
+		return nil
+	}
+
+	var recRoot any
+	if err := json.Unmarshal([]byte(recorded), &recRoot); err == nil {
+		sanitized, _, err := redaction.SanitizeJSON(replayed, policy)
+		if err != nil {
+			return []BodyDiff{{Kind: "type", Recorded: "json", Replayed: truncateText(replayed)}}
+		}
+		var repRoot any
+		_ = json.Unmarshal(sanitized, &repRoot)
+
+		var out []BodyDiff
+		diffJSON("", recRoot, repRoot, &out)
+		return out
+	}
+
+	sanitized := sanitizeReplayedText(contentType, replayed, policy)
+	if recorded != sanitized {
+		return []BodyDiff{{
+			Kind:     "changed",
+			Recorded: truncateText([]byte(recorded)),
+			Replayed: truncateText([]byte(sanitized)),
+		}}
+	}
+	return nil
+}
+
+// sanitizeReplayedText redacts a non-JSON replayed body the way a captured
+// body of its content type is redacted, or with the value rules alone when it
+// has no handler of its own.
+func sanitizeReplayedText(contentType string, replayed []byte, policy redaction.Policy) string {
+	if sanitized, _, _ := redaction.SanitizeBody(contentType, replayed, "resp", policy); sanitized != "" {
+		return sanitized
+	}
+	sanitized, _ := redaction.SanitizeText(string(replayed), policy)
+	return sanitized
+}
+
+// diffBlobs compares a binary or truncated response by the hash of the whole
+// body. Both sides are summarized by size and digest rather than shown. A
+// replayed body that wasn't read to the end, or a recorded one too large to
+// hash, can't be compared.
+func diffBlobs(e *models.Event, resp *Response) []BodyDiff {
+	recorded := fmt.Sprintf("%d bytes, sha256 %s", e.RespBodySize, e.RespBodySHA256)
+	size, digest := resp.bodyDigest()
+	if resp.BodyIncomplete || e.RespBodySHA256 == "" {
+		if e.RespBodySHA256 == "" {
+			recorded = fmt.Sprintf("%d bytes, no hash", e.RespBodySize)
+		}
+		replayed := fmt.Sprintf("%d bytes, sha256 %s", size, digest)
+		if resp.BodyIncomplete {
+			replayed = fmt.Sprintf("incomplete body, %d bytes read", size)
+		}
+		return []BodyDiff{{Kind: "unknown", Recorded: recorded, Replayed: replayed}}
+	}
+	if digest == e.RespBodySHA256 {
+		return nil
+	}
+	return []BodyDiff{{
+		Kind:     "changed",
+		Recorded: recorded,
+		Replayed: fmt.Sprintf("%d bytes, sha256 %s", size, digest),
+	}}
+}
+
+// bodyDigest returns the size and hash of the whole replayed body.
+func (r *Response) bodyDigest() (int64, string) {
+	if r.BodySHA256 != "" {
+		return r.BodySize, r.BodySHA256
+	}
+	sum := sha256.Sum256(r.Body)
+	return int64(len(r.Body)), hex.EncodeToString(sum[:])
+}
+
+func diffJSON(path string, recorded, replayed any, out *[]BodyDiff) {
+	// Values redacted at capture time carry no information to compare against.
+	if s, ok := recorded.(string); ok && redaction.IsPlaceholder(s) {
+		return
+	}
+
+	switch rec := recorded.(type) {
+	case map[string]any:
+		rep, ok := replayed.(map[string]any)
+		if !ok {
+			*out = append(*out, BodyDiff{Path: path, Kind: "type", Recorded: jsonKind(recorded), Replayed: jsonKind(replayed)})
+			return
+		}
+
+		keys := make([]string, 0, len(rec)+len(rep))
+		for k := range rec {
+			keys = append(keys, k)
+		}
+		for k := range rep {
+			if _, seen := rec[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			recV, inRec := rec[k]
+			repV, inRep := rep[k]
+			switch {
+			case !inRep:
+				*out = append(*out, BodyDiff{Path: childPath, Kind: "removed", Recorded: recV})
+			case !inRec:
+				*out = append(*out, BodyDiff{Path: childPath, Kind: "added", Replayed: repV})
+			default:
+				diffJSON(childPath, recV, repV, out)
+			}
+		}
+
+	case []any:
+		rep, ok := replayed.([]any)
+		if !ok {
+			*out = append(*out, BodyDiff{Path: path, Kind: "type", Recorded: jsonKind(recorded), Replayed: jsonKind(replayed)})
+			return
+		}
+		for i := 0; i < len(rec) || i < len(rep); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(rep):
+				*out = append(*out, BodyDiff{Path: childPath, Kind: "removed", Recorded: rec[i]})
+			case i >= len(rec):
+				*out = append(*out, BodyDiff{Path: childPath, Kind: "added", Replayed: rep[i]})
+			default:
+				diffJSON(childPath, rec[i], rep[i], out)
+			}
+		}
+
+	default:
+		if jsonKind(recorded) != jsonKind(replayed) {
+			*out = append(*out, BodyDiff{Path: path, Kind: "type", Recorded: recorded, Replayed: replayed})
+			return
+		}
+		if recorded != replayed {
+			*out = append(*out, BodyDiff{Path: path, Kind: "changed", Recorded: recorded, Replayed: replayed})
+		}
+	}
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return "unknown"
+	}
+}
+
+func truncateText(b []byte) string {
+	if len(b) <= maxDiffTextBytes {
+		return string(b)
+	}
+	return string(b[:maxDiffTextBytes]) + "..."
+}
@@ -0,0 +1,195 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+func TestCompareStatusAndHeaders(t *testing.T) {
+	e := &models.Event{
+		Status:      200,
+		RespHeaders: `{"Content-Type":["application/json"],"Date":["Mon, 01 Jan 2024 00:00:00 GMT"],"X-Version":["1"],"Set-Cookie":["[REDACTED]"]}`,
+	}
+	resp := &Response{
+		Status: 201,
+		Headers: http.Header{
+			"Content-Type": {"application/json"},
+			"Date":         {"Tue, 02 Jan 2024 00:00:00 GMT"},
+			"X-Version":    {"2"},
+			"X-Extra":      {"yes"},
+			"Set-Cookie":   {"session=live"},
+		},
+	}
+	policy := redaction.Policy{HeaderDenylist: []redaction.HeaderRule{{Name: "Set-Cookie"}}}
+
+	d := Compare(e, resp, policy)
+	if !d.HasMismatch() || d.RecordedStatus != 200 || d.ReplayedStatus != 201 {
+		t.Errorf("status: %+v", d)
+	}
+	want := []HeaderDiff{
+		{Name: "X-Extra", Replayed: []string{"yes"}},
+		{Name: "X-Version", Recorded: []string{"1"}, Replayed: []string{"2"}},
+	}
+	if !reflect.DeepEqual(d.Headers, want) {
+		t.Errorf("headers = %+v, want %+v", d.Headers, want)
+	}
+}
+
+func TestCompareJSONBodies(t *testing.T) {
+	e := &models.Event{
+		Status: 200,
+		RespBody: `{"id":1,"name":"a","token":"[REDACTED]","roles":["x","y"],` +
+			`"nested":{"n":1,"gone":true},"kind":"s"}`,
+	}
+	resp := &Response{
+		Status:  200,
+		Headers: http.Header{"Content-Type": {"application/json"}},
+		Body: []byte(`{"id":1,"name":"b","token":"live-secret","roles":["x"],` +
+			`"nested":{"n":1,"new":null},"kind":{"s":1}}`),
+	}
+	policy := redaction.Policy{JSONKeyDenylist: []redaction.JSONKeyRule{{Key: "token"}}}
+
+	d := Compare(e, resp, policy)
+	want := []BodyDiff{
+		{Path: "kind", Kind: "type", Recorded: "s", Replayed: map[string]any{"s": float64(1)}},
+		{Path: "name", Kind: "changed", Recorded: "a", Replayed: "b"},
+		{Path: "nested.gone", Kind: "removed", Recorded: true},
+		{Path: "nested.new", Kind: "added"},
+		{Path: "roles[1]", Kind: "removed", Recorded: "y"},
+	}
+	if !reflect.DeepEqual(d.Body, want) {
+		t.Errorf("body diff = %+v, want %+v", d.Body, want)
+	}
+}
+
+func TestCompareEqualJSONBodies(t *testing.T) {
+	e := &models.Event{Status: 200, RespBody: `{"a":[1,2,{"b":"c"}],"secret":"[REDACTED:0123456789ab]"}`}
+	resp := &Response{Status: 200, Headers: http.Header{}, Body: []byte(`{"secret":42,"a":[1,2,{"b":"c"}]}`)}
+	if d := Compare(e, resp, redaction.Policy{}); d.HasMismatch() {
+		t.Errorf("equal bodies reported %+v", d)
+	}
+}
+
+func TestCompareNonJSONBodies(t *testing.T) {
+	e := &models.Event{Status: 200, RespBody: `{"a":1}`}
+	resp := &Response{Status: 200, Headers: http.Header{}, Body: []byte("<html>")}
+	want := []BodyDiff{{Kind: "type", Recorded: "json", Replayed: "<html>"}}
+	if d := Compare(e, resp, redaction.Policy{}); !reflect.DeepEqual(d.Body, want) {
+		t.Errorf("json vs html = %+v, want %+v", d.Body, want)
+	}
+
+	policy := redaction.Policy{ValueRules: []redaction.ValueRule{{Name: "bearer_token", Detector: redaction.DetectorBearerToken}}}
+	text := &models.Event{Status: 200, RespBody: "use Bearer [REDACTED] now"}
+	same := &Response{Status: 200, Headers: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("use Bearer abcdefgh12345678 now")}
+	if d := Compare(text, same, policy); d.Body != nil {
+		t.Errorf("redacted text reported %+v", d.Body)
+	}
+	other := &Response{Status: 200, Headers: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("something else")}
+	want = []BodyDiff{{Kind: "changed", Recorded: "use Bearer [REDACTED] now", Replayed: "something else"}}
+	if d := Compare(text, other, policy); !reflect.DeepEqual(d.Body, want) {
+		t.Errorf("changed text = %+v, want %+v", d.Body, want)
+	}
+
+	uncaptured := &models.Event{Status: 200}
+	if d := Compare(uncaptured, other, policy); d.Body != nil {
+		t.Errorf("uncaptured body reported %+v", d.Body)
+	}
+}
+
+func TestCompareBlobs(t *testing.T) {
+	body := []byte{0x00, 0x01, 0x02, 0xff}
+	sum := sha256.Sum256(body)
+	e := &models.Event{
+		Status:           200,
+		RespBody:         "AAEC/w==",
+		RespBodyEncoding: models.BodyEncodingBase64,
+		RespBodySize:     len(body),
+		RespBodySHA256:   hex.EncodeToString(sum[:]),
+	}
+	if d := Compare(e, &Response{Status: 200, Headers: http.Header{}, Body: body}, redaction.Policy{}); d.HasMismatch() {
+		t.Errorf("same blob reported %+v", d.Body)
+	}
+
+	d := Compare(e, &Response{Status: 200, Headers: http.Header{}, Body: []byte{0x00}}, redaction.Policy{})
+	if len(d.Body) != 1 || d.Body[0].Kind != "changed" {
+		t.Errorf("different blob = %+v", d.Body)
+	}
+
+	// Truncated text bodies are compared by the hash of the whole body too.
+	full := []byte(`{"a":"long body"}`)
+	sum = sha256.Sum256(full)
+	truncated := &models.Event{
+		Status:            200,
+		RespBody:          `{"a":"lo`,
+		RespBodyTruncated: true,
+		RespBodySize:      len(full),
+		RespBodySHA256:    hex.EncodeToString(sum[:]),
+	}
+	if d := Compare(truncated, &Response{Status: 200, Headers: http.Header{}, Body: full}, redaction.Policy{}); d.HasMismatch() {
+		t.Errorf("truncated body with the same hash reported %+v", d.Body)
+	}
+}
+
+func TestCompareBodyOverCap(t *testing.T) {
+	full := bytes.Repeat([]byte("a"), maxReplayResponseBytes+10)
+	sum := sha256.Sum256(full)
+	e := &models.Event{
+		Status:            200,
+		RespBody:          "aaaa",
+		RespBodyTruncated: true,
+		RespBodySize:      len(full),
+		RespBodySHA256:    hex.EncodeToString(sum[:]),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(full)
+	}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := readResponse(res)
+	res.Body.Close()
+	if len(resp.Body) != maxReplayResponseBytes || !resp.BodyTruncated || resp.BodyIncomplete {
+		t.Fatalf("kept %d bytes, truncated %v, incomplete %v", len(resp.Body), resp.BodyTruncated, resp.BodyIncomplete)
+	}
+	resp.Headers = http.Header{}
+	if d := Compare(e, resp, redaction.Policy{}); d.HasMismatch() {
+		t.Errorf("same body over the cap reported %+v", d.Body)
+	}
+
+	other := *resp
+	other.BodySHA256 = "different"
+	if d := Compare(e, &other, redaction.Policy{}); !d.HasMismatch() || d.Body[0].Kind != "changed" {
+		t.Errorf("different body over the cap = %+v", d.Body)
+	}
+
+	incomplete := *resp
+	incomplete.BodyIncomplete = true
+	d := Compare(e, &incomplete, redaction.Policy{})
+	if d.HasMismatch() || len(d.Body) != 1 || d.Body[0].Kind != "unknown" {
+		t.Errorf("incomplete body = %+v", d.Body)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	long := make([]byte, maxDiffTextBytes+10)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if got := truncateText(long); len(got) != maxDiffTextBytes+3 || got[maxDiffTextBytes:] != "..." {
+		t.Errorf("truncateText kept %d bytes", len(got))
+	}
+	if got := truncateText([]byte("short")); got != "short" {
+		t.Errorf("truncateText(short) = %q", got)
+	}
+}
@@ -0,0 +1,79 @@
+package replay
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/store"
+)
+
+// How long a finished replay stays queryable before it is pruned.
+const finishedReplayRetention = 10 * time.Minute
+
+// Registry tracks every replay run by ID so several replays can run side by side.
+// Each run is also persisted so its results outlive the process.
+type Registry struct {
+	mu     sync.RWMutex
+	db     *sql.DB
+	states map[string]*ReplayState
+}
+
+func NewRegistry(db *sql.DB) (*Registry, error) {
+	if err := store.MarkInterruptedReplayRuns(db, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		return nil, err
+	}
+	return &Registry{
+		db:     db,
+		states: make(map[string]*ReplayState),
+	}, nil
+}
+
+// Start persists run and registers a running replay state for it.
+func (r *Registry) Start(run *models.ReplayRun) (*ReplayState, error) {
+	run.Outcome = models.ReplayOutcomeRunning
+	if err := store.InsertReplayRun(r.db, run); err != nil {
+		return nil, err
+	}
+
+	state := NewReplayState()
+	state.db = r.db
+	state.run = run
+	state.Start(run.Id, run.SessionId, run.Target, run.Speed)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+	r.states[run.Id] = state
+	return state, nil
+}
+
+// Get returns the state for replayId, or nil if it is unknown.
+func (r *Registry) Get(replayId string) *ReplayState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.states[replayId]
+}
+
+// Stop stops the replay and forgets it.
+func (r *Registry) Stop(replayId string) {
+	r.mu.Lock()
+	state, ok := r.states[replayId]
+	delete(r.states, replayId)
+	r.mu.Unlock()
+
+	if ok {
+		state.Stop()
+	}
+}
+
+// pruneLocked drops replays that finished more than finishedReplayRetention ago.
+// Caller must hold r.mu.
+func (r *Registry) pruneLocked() {
+	for id, state := range r.states {
+		if doneAt, done := state.doneAt(); done && time.Since(doneAt) > finishedReplayRetention {
+			delete(r.states, id)
+		}
+	}
+}
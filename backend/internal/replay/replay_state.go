@@ -1,11 +1,16 @@
 package replay
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"log"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/store"
 )
 
 type Status string
@@ -24,6 +29,17 @@ type ReplayState struct {
 	sessionId  string
 	currentSeq int
 	speed      float64
+	target     string
+	sent       int
+	failed     int
+	lastStatus int
+	lastError  string
+	diffs      []*Diff
+	finishedAt time.Time
+
+	// db and run persist the run's history; both are nil for untracked states.
+	db  *sql.DB
+	run *models.ReplayRun
 
 	stopC       chan struct{}
 	pauseC      chan struct{}
@@ -40,14 +56,20 @@ func NewReplayState() *ReplayState {
 	}
 }
 
-func (s *ReplayState) Start(replayId, sessionId string, speed float64) {
+func (s *ReplayState) Start(replayId, sessionId, target string, speed float64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.status = StatusRunning
 	s.replayId = replayId
 	s.sessionId = sessionId
+	s.target = target
 	s.currentSeq = 0
 	s.speed = speed
+	s.sent = 0
+	s.failed = 0
+	s.lastStatus = 0
+	s.lastError = ""
+	s.diffs = nil
 	s.stopC = make(chan struct{})
 	s.pauseC = make(chan struct{}, 2) // capacity 2: one for Pause(), one for Step() re-queue
 	s.resumeC = make(chan struct{}, 1)
@@ -61,10 +83,12 @@ func (s *ReplayState) Stop() {
 	defer s.mu.Unlock()
 	if s.status == StatusRunning || s.status == StatusPaused {
 		close(s.stopC)
+		s.persistOutcome(models.ReplayOutcomeStopped)
 	}
 	s.status = StatusIdle
 	s.replayId = ""
 	s.sessionId = ""
+	s.target = ""
 	s.currentSeq = 0
 	s.speed = 0
 	s.broadcast(s.marshalEvent())
@@ -130,6 +154,15 @@ func (s *ReplayState) MarkDone() {
 	defer s.mu.Unlock()
 	if s.status == StatusRunning || s.status == StatusPaused {
 		s.status = StatusDone
+		s.finishedAt = time.Now()
+		switch {
+		case s.failed > 0:
+			s.persistOutcome(models.ReplayOutcomeFailed)
+		case len(s.diffs) > 0:
+			s.persistOutcome(models.ReplayOutcomeMismatched)
+		default:
+			s.persistOutcome(models.ReplayOutcomePassed)
+		}
 	}
 	s.broadcast(s.marshalEvent())
 	s.closeAllSubscribers()
@@ -143,12 +176,72 @@ func (s *ReplayState) SetSeq(seq int) {
 	s.broadcast(s.marshalEvent())
 }
 
+// RecordResult is called by the scheduler after each event has been re-issued.
+// A zero ReplayedStatus means the request never got a response; Error says why.
+func (s *ReplayState) RecordResult(r *models.ReplayResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currentSeq = r.Seq
+	s.sent++
+	if r.Error != "" {
+		s.failed++
+	}
+	s.lastStatus = r.ReplayedStatus
+	s.lastError = r.Error
+	if s.db != nil {
+		if err := store.InsertReplayResult(s.db, r); err != nil {
+			log.Printf("replay %s: failed to persist result: %v", s.replayId, err)
+		}
+	}
+	s.broadcast(s.marshalEvent())
+}
+
+// RecordDiff stores a response mismatch for this run and streams it to subscribers.
+func (s *ReplayState) RecordDiff(d *Diff) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diffs = append(s.diffs, d)
+	b, _ := json.Marshal(struct {
+		Type     string `json:"type"`
+		ReplayId string `json:"replay_id"`
+		Diff     *Diff  `json:"diff"`
+	}{
+		Type:     "diff",
+		ReplayId: s.replayId,
+		Diff:     d,
+	})
+	s.broadcast(b)
+}
+
+// Diffs returns the mismatches recorded so far for the current run.
+func (s *ReplayState) Diffs() []*Diff {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Diff, len(s.diffs))
+	copy(out, s.diffs)
+	return out
+}
+
+// Progress returns the replay target and how many events have been sent so far.
+func (s *ReplayState) Progress() (target string, sent, failed int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.target, s.sent, s.failed
+}
+
 func (s *ReplayState) Get() (status Status, replayId, sessionId string, currentSeq int, speed float64) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.status, s.replayId, s.sessionId, s.currentSeq, s.speed
 }
 
+// doneAt reports when the replay finished, if it has.
+func (s *ReplayState) doneAt() (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.finishedAt, s.status == StatusDone
+}
+
 // speed returns the current speed factor. Safe to call from the scheduler goroutine.
 func (s *ReplayState) getSpeed() float64 {
 	s.mu.RLock()
@@ -205,20 +298,47 @@ func (s *ReplayState) WSSnapshot() []byte {
 	return s.marshalEvent()
 }
 
+// persistOutcome stores the run's final counters. Caller must hold s.mu.
+func (s *ReplayState) persistOutcome(outcome string) {
+	if s.db == nil || s.run == nil {
+		return
+	}
+	s.run.Outcome = outcome
+	s.run.EndedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	s.run.Sent = s.sent
+	s.run.Failed = s.failed
+	s.run.Mismatched = len(s.diffs)
+	if err := store.FinishReplayRun(s.db, s.run); err != nil {
+		log.Printf("replay %s: failed to persist outcome: %v", s.replayId, err)
+	}
+}
+
 // marshalEvent builds the JSON message for the current state.
 // Caller must hold s.mu (at least read lock).
 func (s *ReplayState) marshalEvent() []byte {
 	type wsEvent struct {
+		Type       string  `json:"type"`
 		ReplayId   string  `json:"replay_id"`
 		Status     Status  `json:"status"`
 		CurrentSeq int     `json:"current_seq"`
 		Speed      float64 `json:"speed"`
+		Sent       int     `json:"sent"`
+		Failed     int     `json:"failed"`
+		LastStatus int     `json:"last_status,omitempty"`
+		LastError  string  `json:"last_error,omitempty"`
+		Mismatched int     `json:"mismatched"`
 	}
 	b, _ := json.Marshal(wsEvent{
+		Type:       "state",
 		ReplayId:   s.replayId,
 		Status:     s.status,
 		CurrentSeq: s.currentSeq,
 		Speed:      s.speed,
+		Sent:       s.sent,
+		Failed:     s.failed,
+		LastStatus: s.lastStatus,
+		LastError:  s.lastError,
+		Mismatched: len(s.diffs),
 	})
 	return b
 }
@@ -1,25 +1,71 @@
 package replay
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"time"
 
 	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
 )
 
-// Run walks the provided events in seq order, emitting each one and waiting the
-// recorded inter-event delay scaled by the replay speed. It returns when all
-// events have been emitted, or when the replay is stopped via state.Stop().
+// Run walks the provided events in seq order, re-issuing each one through sender
+// and waiting the recorded inter-event delay scaled by the replay speed.
+// Responses are redacted with policy before being compared to the recording.
+// It returns when all events have been sent, or when the replay is stopped via
+// state.Stop().
 //
-// Call this in a goroutine: go Run(replayId, events, state)
-func Run(replayId string, events []*models.Event, state *ReplayState) {
+// Call this in a goroutine: go Run(replayId, events, state, sender, policy)
+func Run(replayId string, events []*models.Event, state *ReplayState, sender *Sender, policy redaction.Policy) {
 	defer state.MarkDone()
 
 	stopC, pauseC, resumeC, stepC, speedC := state.Channels()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	for i, e := range events {
 		state.SetSeq(e.Seq)
-		log.Printf("[replay %s] seq=%d %s %s %d", replayId, e.Seq, e.Method, e.URL, e.Status)
+
+		sentAt := time.Now()
+		result := &models.ReplayResult{
+			ReplayId:       replayId,
+			Seq:            e.Seq,
+			EventId:        e.Id,
+			Method:         e.Method,
+			URL:            e.URL,
+			SentAt:         sentAt.UTC().Format(time.RFC3339Nano),
+			RecordedStatus: e.Status,
+		}
+
+		resp, err := sender.Send(ctx, e)
+		if err != nil {
+			if ctx.Err() != nil {
+				return // stopped mid-request
+			}
+			log.Printf("[replay %s] seq=%d %s %s failed: %v", replayId, e.Seq, e.Method, e.URL, err)
+			result.Error = err.Error()
+		} else {
+			log.Printf("[replay %s] seq=%d %s %s recorded=%d replayed=%d", replayId, e.Seq, e.Method, e.URL, e.Status, resp.Status)
+			result.ReplayedStatus = resp.Status
+			result.DurationMs = resp.Duration.Milliseconds()
+			if d := Compare(e, resp, policy); d.HasMismatch() {
+				result.Diff, _ = json.Marshal(d)
+				state.RecordDiff(d)
+			} else if len(d.Body) > 0 {
+				// Kept on the result, without counting as a mismatch.
+				result.Diff, _ = json.Marshal(d)
+			}
+		}
+		state.RecordResult(result)
 
 		if i == len(events)-1 {
 			// Last event — nothing to wait for.
@@ -27,7 +73,12 @@ func Run(replayId string, events []*models.Event, state *ReplayState) {
 		}
 
 		next := events[i+1]
-		delay := interEventDelay(e, next, state.getSpeed())
+		// The recorded gap is measured between request starts, so time spent
+		// waiting on the target counts towards it.
+		delay := interEventDelay(e, next, state.getSpeed()) - time.Since(sentAt)
+		if delay < 0 {
+			delay = 0
+		}
 
 		if !waitOrInterrupt(delay, stopC, pauseC, resumeC, stepC, speedC, state.getSpeed) {
 			return // stopped
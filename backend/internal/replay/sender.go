@@ -0,0 +1,339 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shigawire-dev/internal/contentcoding"
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+	"github.com/shigawire-dev/internal/upstream"
+	"github.com/shigawire-dev/internal/vault"
+)
+
+const maxReplayResponseBytes = 8 * 1024 * 1024
+
+// Response is what the target returned for one replayed event. Body holds at
+// most maxReplayResponseBytes of the decoded body; BodySize and BodySHA256
+// describe all of it. BodyIncomplete is set when the body couldn't be read or
+// decoded to the end.
+type Response struct {
+	Status         int
+	Headers        http.Header
+	Body           []byte
+	BodySize       int64
+	BodySHA256     string
+	BodyTruncated  bool
+	BodyIncomplete bool
+	Duration       time.Duration
+
+	// Set for WebSocket events: the messages the target sent back, and the
+	// server messages captured at recording time to compare them against.
+	Frames         []Frame
+	RecordedFrames []*models.WSFrame
+}
+
+// Sender rebuilds recorded requests and issues them against Target. When
+// KeepRecordedHost is set, events captured in forward-proxy mode are sent back
+// to the host they were recorded with instead, using HostClient rather than
+// Client, which carries the project's upstream settings. DB is used to load
+// the frames of recorded WebSocket connections. Routes, when set, send events
+// back through the project's routing table: to the route they were recorded
+// through, or to the one their path matches now.
+//
+// Redacted values are sent as the live value the target returned in their
+// place earlier in the same replay, where one is known (see tokenChain), and
+// otherwise as the original from Vault when one is configured.
+type Sender struct {
+	DB               *sql.DB
+	Target           string
+	KeepRecordedHost bool
+	Routes           []models.UpstreamRoute
+	Client           *http.Client
+	HostClient       *http.Client
+	Vault            *vault.Vault
+	// RequestTimeout bounds each replayed HTTP exchange, reading the
+	// response body included, so a stalled target can't hold up the replay.
+	RequestTimeout time.Duration
+
+	chain     *tokenChain
+	sessionId string
+	originals map[string]string
+}
+
+// DefaultRequestTimeout is the RequestTimeout of a new Sender.
+const DefaultRequestTimeout = 30 * time.Second
+
+// NewSender returns a sender whose clients use the default upstream settings.
+func NewSender(db *sql.DB, target string, keepRecordedHost bool) *Sender {
+	return &Sender{
+		DB:               db,
+		Target:           target,
+		KeepRecordedHost: keepRecordedHost,
+		Client:           newClient(),
+		HostClient:       newClient(),
+		RequestTimeout:   DefaultRequestTimeout,
+		chain:            newTokenChain(),
+		originals:        make(map[string]string),
+	}
+}
+
+func newClient() *http.Client {
+	return &http.Client{
+		Transport: upstream.Default,
+		// A replay must reproduce the recorded exchange, not follow it somewhere else.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// clientFor returns the client e is sent with.
+func (s *Sender) clientFor(e *models.Event) *http.Client {
+	if s.KeepRecordedHost {
+		if u, err := url.ParseRequestURI(e.URL); err == nil && u.IsAbs() {
+			return s.HostClient
+		}
+	}
+	return s.Client
+}
+
+// resolve returns the value to send in place of a redaction placeholder.
+// Decrypted originals are cached in memory for the rest of the replay.
+func (s *Sender) resolve(placeholder string) (string, bool) {
+	if v, ok := s.chain.resolve(placeholder); ok {
+		return v, true
+	}
+	if s.Vault == nil || !redaction.IsTokenized(placeholder) {
+		return "", false
+	}
+	if v, ok := s.originals[placeholder]; ok {
+		return v, true
+	}
+
+	v, ok, err := s.Vault.Lookup(s.DB, s.sessionId, placeholder)
+	if err != nil {
+		log.Printf("replay: vault lookup: %v", err)
+	}
+	if ok {
+		s.originals[placeholder] = v
+	}
+	return v, ok
+}
+
+// Send replays e against the sender's target and reads the response.
+func (s *Sender) Send(ctx context.Context, e *models.Event) (*Response, error) {
+	s.sessionId = e.SessionId
+	if isWebSocketEvent(e) {
+		return s.sendWebSocket(ctx, e)
+	}
+
+	if s.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RequestTimeout)
+		defer cancel()
+	}
+	req, err := s.buildRequest(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := s.clientFor(e).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out := readResponse(resp)
+	out.Duration = time.Since(start)
+	s.chain.learn(e, out)
+	return out, nil
+}
+
+// readResponse reads a replayed response to the end of its body. The body is
+// decoded, as recorded bodies are stored decoded, and hashed as it streams, so
+// a body longer than what is kept can still be compared by its hash.
+func readResponse(resp *http.Response) *Response {
+	var body io.Reader = resp.Body
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		// Bodies in a coding we can't decode are compared as sent.
+		if d, err := contentcoding.NewReader(resp.Body, ce); err == nil {
+			defer d.Close()
+			body = d
+		}
+	}
+
+	b := &replayBody{hash: sha256.New()}
+	_, err := io.Copy(b, body)
+	return &Response{
+		Status:         resp.StatusCode,
+		Headers:        resp.Header,
+		Body:           b.buf.Bytes(),
+		BodySize:       b.size,
+		BodySHA256:     hex.EncodeToString(b.hash.Sum(nil)),
+		BodyTruncated:  b.size > int64(b.buf.Len()),
+		BodyIncomplete: err != nil,
+	}
+}
+
+// replayBody keeps the first maxReplayResponseBytes written to it, and the
+// size and hash of everything.
+type replayBody struct {
+	buf  bytes.Buffer
+	size int64
+	hash hash.Hash
+}
+
+func (b *replayBody) Write(p []byte) (int, error) {
+	b.size += int64(len(p))
+	b.hash.Write(p)
+	if room := maxReplayResponseBytes - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (s *Sender) buildRequest(ctx context.Context, e *models.Event) (*http.Request, error) {
+	target, err := s.eventURL(e)
+	if err != nil {
+		return nil, fmt.Errorf("build target url: %w", err)
+	}
+
+	var body io.Reader
+	switch {
+	case e.ReqBodyEncoding == models.BodyEncodingBase64:
+		b, err := models.DecodeBody(e.ReqBody, e.ReqBodyEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("decode request body: %w", err)
+		}
+		body = bytes.NewReader(b)
+	case e.ReqBody != "":
+		body = strings.NewReader(s.resolveBody(e.ReqBody))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, e.Method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+
+	headers, err := s.replayHeaders(e)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = headers
+
+	return req, nil
+}
+
+// replayHeaders returns the recorded request headers that can be sent again.
+func (s *Sender) replayHeaders(e *models.Event) (http.Header, error) {
+	var recorded http.Header
+	if e.ReqHeaders != "" {
+		if err := json.Unmarshal([]byte(e.ReqHeaders), &recorded); err != nil {
+			return nil, fmt.Errorf("parse recorded headers: %w", err)
+		}
+	}
+
+	headers := http.Header{}
+	for k, values := range recorded {
+		if skipReplayHeader(k) {
+			continue
+		}
+		for _, v := range values {
+			// Redacted values without a live substitute can't be sent faithfully;
+			// omitting them is closer to the original request than sending the
+			// placeholder.
+			v = s.resolveText(v)
+			if redaction.ContainsPlaceholder(v) {
+				continue
+			}
+			headers.Add(k, v)
+		}
+	}
+	// The stored body was decoded at capture time and is sent as is.
+	if e.ReqBodyContentEncoding != "" {
+		headers.Del("Content-Encoding")
+	}
+	return headers, nil
+}
+
+// eventURL returns the URL e is replayed to.
+func (s *Sender) eventURL(e *models.Event) (string, error) {
+	recorded := s.resolveURL(e.URL)
+	in, err := url.ParseRequestURI(recorded)
+	if err != nil {
+		return "", err
+	}
+	if in.IsAbs() {
+		return targetURL(s.Target, recorded, s.KeepRecordedHost)
+	}
+
+	route, strip, ok := eventRoute(s.Routes, e.UpstreamRoute, in.Path)
+	if !ok {
+		return targetURL(s.Target, recorded, s.KeepRecordedHost)
+	}
+	in.Path = strings.TrimPrefix(in.Path, strip)
+	if !strings.HasPrefix(in.Path, "/") {
+		in.Path = "/" + in.Path
+	}
+	in.RawPath = ""
+	return targetURL(route.Upstream, in.RequestURI(), false)
+}
+
+// eventRoute returns the route an event recorded through the named route, or
+// with no route, is replayed through.
+func eventRoute(routes []models.UpstreamRoute, name, path string) (models.UpstreamRoute, string, bool) {
+	for _, r := range routes {
+		if name != "" && r.Name == name {
+			strip, _ := r.Match(path)
+			return r, strip, true
+		}
+	}
+	return models.MatchUpstreamRoute(routes, path)
+}
+
+// targetURL joins the recorded request URI onto the replay target base URL.
+// Absolute recorded URLs are used as-is when keepRecordedHost is set.
+func targetURL(base, recorded string, keepRecordedHost bool) (string, error) {
+	in, err := url.ParseRequestURI(recorded)
+	if err != nil {
+		return "", err
+	}
+	if keepRecordedHost && in.IsAbs() {
+		return in.String(), nil
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/") + in.Path
+	u.RawPath = ""
+	u.RawQuery = in.RawQuery
+	return u.String(), nil
+}
+
+func skipReplayHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Host", "Content-Length", "Connection", "Proxy-Connection", "Keep-Alive",
+		"Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+		// Regenerated by the WebSocket dialer for every handshake.
+		"Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package replay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+func TestSendStalledBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	e := &models.Event{Method: http.MethodGet, URL: "/slow", ReqHeaders: `{}`}
+
+	s := NewSender(nil, srv.URL, false)
+	s.RequestTimeout = 50 * time.Millisecond
+	resp, err := s.Send(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.BodyIncomplete || string(resp.Body) != "partial" {
+		t.Errorf("stalled body read as %q, incomplete %v", resp.Body, resp.BodyIncomplete)
+	}
+
+	// Stopping the replay cancels a request in flight.
+	s.RequestTimeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if resp, err = s.Send(ctx, e); err != nil || !resp.BodyIncomplete {
+		t.Errorf("stopped send = %+v, %v", resp, err)
+	}
+}
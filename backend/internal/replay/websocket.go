@@ -0,0 +1,264 @@
+package replay
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/redaction"
+	"github.com/shigawire-dev/internal/store"
+	"github.com/shigawire-dev/internal/upstream"
+)
+
+// How long a replayed connection waits for further server messages before it
+// is closed, once all recorded client messages have been sent.
+const wsReplayIdleTimeout = 5 * time.Second
+
+// Frame is a data message received from the target on a replayed WebSocket.
+type Frame struct {
+	Opcode int
+	Data   []byte
+}
+
+func isWebSocketEvent(e *models.Event) bool {
+	if e.Status != http.StatusSwitchingProtocols {
+		return false
+	}
+	var headers http.Header
+	if err := json.Unmarshal([]byte(e.ReqHeaders), &headers); err != nil {
+		return false
+	}
+	return strings.EqualFold(headers.Get("Upgrade"), "websocket")
+}
+
+// sendWebSocket reopens a recorded WebSocket connection against the target and
+// sends the recorded client messages with their original spacing, collecting
+// whatever the target sends back.
+func (s *Sender) sendWebSocket(ctx context.Context, e *models.Event) (*Response, error) {
+	recorded, err := store.ListWSFramesByEvent(s.DB, e.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.eventURL(e)
+	if err != nil {
+		return nil, fmt.Errorf("build target url: %w", err)
+	}
+	headers, err := s.replayHeaders(e)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: 30 * time.Second}
+	if t, ok := s.clientFor(e).Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = upstream.WebSocketTLSConfig(t)
+	}
+
+	start := time.Now()
+	conn, resp, err := dialer.DialContext(ctx, webSocketURL(target), headers)
+	if err != nil {
+		if resp == nil {
+			return nil, err
+		}
+		// The target refused the upgrade; report its answer as the response.
+		defer resp.Body.Close()
+		out := readResponse(resp)
+		out.Duration = time.Since(start)
+		return out, nil
+	}
+	defer conn.Close()
+
+	r := &frameCollector{notify: make(chan struct{}, 1), done: make(chan struct{})}
+	go r.read(conn)
+
+	closeSent := false
+	last := parseTime(e.StartedAt)
+	for _, f := range recorded {
+		if f.Direction != models.WSDirectionClient {
+			continue
+		}
+
+		if at := parseTime(f.Timestamp); !at.IsZero() && !last.IsZero() && at.After(last) {
+			select {
+			case <-time.After(at.Sub(last)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			last = at
+		}
+
+		data, err := s.framePayload(f)
+		if err != nil {
+			return nil, fmt.Errorf("decode frame %d: %w", f.Seq, err)
+		}
+
+		switch f.Opcode {
+		case models.WSOpcodeText, models.WSOpcodeBinary:
+			err = conn.WriteMessage(f.Opcode, data)
+		case models.WSOpcodePing:
+			err = conn.WriteControl(websocket.PingMessage, data, time.Now().Add(time.Second))
+		case models.WSOpcodeClose:
+			err = conn.WriteControl(websocket.CloseMessage, data, time.Now().Add(time.Second))
+			closeSent = true
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	r.waitFor(ctx, countServerMessages(recorded))
+	if !closeSent {
+		_ = conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	}
+	select {
+	case <-r.done:
+	case <-time.After(time.Second):
+	}
+
+	return &Response{
+		Status:         resp.StatusCode,
+		Headers:        resp.Header,
+		Duration:       time.Since(start),
+		Frames:         r.frames(),
+		RecordedFrames: serverMessages(recorded),
+	}, nil
+}
+
+// frameCollector gathers the data messages read from a replayed connection.
+type frameCollector struct {
+	mu       sync.Mutex
+	received []Frame
+	notify   chan struct{}
+	done     chan struct{}
+}
+
+func (c *frameCollector) read(conn *websocket.Conn) {
+	defer close(c.done)
+	for {
+		opcode, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.received = append(c.received, Frame{Opcode: opcode, Data: data})
+		c.mu.Unlock()
+
+		select {
+		case c.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// waitFor blocks until want messages have arrived, the connection closes, or
+// the target stays silent for wsReplayIdleTimeout.
+func (c *frameCollector) waitFor(ctx context.Context, want int) {
+	for len(c.frames()) < want {
+		select {
+		case <-c.notify:
+		case <-c.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(wsReplayIdleTimeout):
+			return
+		}
+	}
+}
+
+func (c *frameCollector) frames() []Frame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Frame(nil), c.received...)
+}
+
+// diffFrames compares the server messages of a replayed connection with the
+// recorded ones, in order. Paths are prefixed with the message index
+// ("frames[2].user.id").
+func diffFrames(recorded []*models.WSFrame, replayed []Frame, policy redaction.Policy) []BodyDiff {
+	var out []BodyDiff
+	for i := 0; i < len(recorded) || i < len(replayed); i++ {
+		path := fmt.Sprintf("frames[%d]", i)
+		switch {
+		case i >= len(replayed):
+			out = append(out, BodyDiff{Path: path, Kind: "removed", Recorded: recorded[i].Payload})
+		case i >= len(recorded):
+			out = append(out, BodyDiff{Path: path, Kind: "added", Replayed: truncateText(replayed[i].Data)})
+		case recorded[i].Opcode != replayed[i].Opcode:
+			out = append(out, BodyDiff{Path: path, Kind: "type", Recorded: opcodeName(recorded[i].Opcode), Replayed: opcodeName(replayed[i].Opcode)})
+		default:
+			data := replayed[i].Data
+			if recorded[i].PayloadEncoding == "base64" {
+				data = []byte(base64.StdEncoding.EncodeToString(data))
+			}
+			for _, d := range diffBodies(recorded[i].Payload, "", data, policy) {
+				if d.Path == "" {
+					d.Path = path
+				} else if strings.HasPrefix(d.Path, "[") {
+					d.Path = path + d.Path
+				} else {
+					d.Path = path + "." + d.Path
+				}
+				out = append(out, d)
+			}
+		}
+	}
+	return out
+}
+
+func serverMessages(frames []*models.WSFrame) []*models.WSFrame {
+	out := []*models.WSFrame{}
+	for _, f := range frames {
+		if f.Direction == models.WSDirectionServer &&
+			(f.Opcode == models.WSOpcodeText || f.Opcode == models.WSOpcodeBinary) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func countServerMessages(frames []*models.WSFrame) int {
+	return len(serverMessages(frames))
+}
+
+func (s *Sender) framePayload(f *models.WSFrame) ([]byte, error) {
+	if f.PayloadEncoding == "base64" {
+		return base64.StdEncoding.DecodeString(f.Payload)
+	}
+	return []byte(s.resolveBody(f.Payload)), nil
+}
+
+func opcodeName(opcode int) string {
+	switch opcode {
+	case models.WSOpcodeText:
+		return "text"
+	case models.WSOpcodeBinary:
+		return "binary"
+	}
+	return fmt.Sprintf("opcode_%d", opcode)
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+// webSocketURL maps an http(s) target URL onto the matching ws(s) scheme.
+func webSocketURL(target string) string {
+	switch {
+	case strings.HasPrefix(target, "https://"):
+		return "wss://" + strings.TrimPrefix(target, "https://")
+	case strings.HasPrefix(target, "http://"):
+		return "ws://" + strings.TrimPrefix(target, "http://")
+	}
+	return target
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Bodies shorter than this are stored uncompressed; the zstd frame overhead
+// would outweigh the savings.
+const minCompressedBodyBytes = 256
+
+const bodyCompressionZstd = "zstd"
+
+// Both are safe for concurrent EncodeAll/DecodeAll calls.
+var (
+	bodyEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	bodyDecoder, _ = zstd.NewReader(nil)
+)
+
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// putBody stores a body in the content-addressed bodies table and returns its
+// reference, the hex SHA-256 of the content. Storing content that is already
+// there costs nothing; reference counts are kept by the events triggers.
+func putBody(db execer, content string) (string, error) {
+	if content == "" {
+		return "", nil
+	}
+	sum := sha256.Sum256([]byte(content))
+	ref := hex.EncodeToString(sum[:])
+
+	data, compression := []byte(content), ""
+	if len(content) >= minCompressedBodyBytes {
+		if compressed := bodyEncoder.EncodeAll(data, nil); len(compressed) < len(data) {
+			data, compression = compressed, bodyCompressionZstd
+		}
+	}
+
+	if _, err := db.Exec(
+		`INSERT INTO bodies(hash, compression, size, data) VALUES(?, ?, ?, ?)
+		 ON CONFLICT(hash) DO NOTHING`,
+		ref, compression, len(content), data,
+	); err != nil {
+		return "", fmt.Errorf("insert body: %w", err)
+	}
+	return ref, nil
+}
+
+// decodeBody returns the content of a row of the bodies table.
+func decodeBody(data []byte, compression string) (string, error) {
+	switch compression {
+	case "":
+		return string(data), nil
+	case bodyCompressionZstd:
+		out, err := bodyDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return "", fmt.Errorf("decompress body: %w", err)
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("unknown body compression %q", compression)
+}
+
+// MoveInlineBodies moves bodies of events stored before the bodies table
+// existed into it, a batch at a time, and returns how many events it moved.
+func (s *Store) MoveInlineBodies() (int, error) {
+	return moveInlineBodies(s.DB)
+}
+
+func moveInlineBodies(db *sql.DB) (int, error) {
+	const batch = 200
+	moved := 0
+	for {
+		n, err := moveInlineBodiesBatch(db, batch)
+		if err != nil {
+			return moved, err
+		}
+		moved += n
+		if n < batch {
+			return moved, nil
+		}
+	}
+}
+
+func moveInlineBodiesBatch(db *sql.DB, limit int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin move bodies tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Query(
+		`SELECT id, COALESCE(req_body, ''), COALESCE(resp_body, '')
+		   FROM events
+		  WHERE COALESCE(req_body, '') != '' OR COALESCE(resp_body, '') != ''
+		  LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("list inline bodies: %w", err)
+	}
+	type inline struct{ id, req, resp string }
+	var pending []inline
+	for rows.Next() {
+		var b inline
+		if err := rows.Scan(&b.id, &b.req, &b.resp); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan inline body: %w", err)
+		}
+		pending = append(pending, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows inline bodies: %w", err)
+	}
+
+	for _, b := range pending {
+		reqRef, err := putBody(tx, b.req)
+		if err != nil {
+			return 0, err
+		}
+		respRef, err := putBody(tx, b.resp)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(
+			`UPDATE events SET req_body = '', resp_body = '', req_body_ref = ?, resp_body_ref = ? WHERE id = ?`,
+			reqRef, respRef, b.id,
+		); err != nil {
+			return 0, fmt.Errorf("update event body refs: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit move bodies: %w", err)
+	}
+	return len(pending), nil
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func insertSessions(t *testing.T, db *sql.DB, projectId string, sessionIds ...string) {
+	t.Helper()
+	if err := InsertProject(db, &models.Project{Id: projectId, Name: projectId, ConfigJSON: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range sessionIds {
+		if err := InsertSession(db, &models.Session{Id: id, ProjectId: projectId, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// refCount returns the reference count of content in the bodies table, or
+// -1 when it isn't stored.
+func refCount(t *testing.T, db *sql.DB, content string) int {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	var n int
+	err := db.QueryRow(`SELECT ref_count FROM bodies WHERE hash = ?`, hex.EncodeToString(sum[:])).Scan(&n)
+	if err == sql.ErrNoRows {
+		return -1
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestBodyRefCounts(t *testing.T) {
+	db := openTestDB(t)
+	insertSessions(t, db, "p", "s1", "s2")
+
+	// Long enough to be stored compressed.
+	shared := `{"items":"` + strings.Repeat("x", 500) + `"}`
+	events := []*models.Event{
+		{Id: "e1", SessionId: "s1", ReqBody: "only e1", RespBody: shared},
+		{Id: "e2", SessionId: "s1", RespBody: shared},
+		{Id: "e3", SessionId: "s2", RespBody: "redacted"},
+	}
+	for _, e := range events {
+		if err := InsertEvent(db, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(step string, want map[string]int) {
+		t.Helper()
+		for content, n := range want {
+			if got := refCount(t, db, content); got != n {
+				t.Errorf("%s: ref count of %.10q = %d, want %d", step, content, got, n)
+			}
+		}
+	}
+	check("insert", map[string]int{shared: 2, "only e1": 1, "redacted": 1})
+
+	e2, err := GetEvent(db, "e2")
+	if err != nil || e2 == nil || e2.RespBody != shared {
+		t.Fatalf("GetEvent(e2) = %+v, %v", e2, err)
+	}
+
+	// Redacting e2 again moves its reference to the new body.
+	e2.RespBody = "redacted"
+	if err := UpdateEventRedaction(db, e2); err != nil {
+		t.Fatal(err)
+	}
+	check("redaction", map[string]int{shared: 1, "redacted": 2})
+
+	// Updating with the same bodies leaves the counts alone.
+	if err := UpdateEventRedaction(db, e2); err != nil {
+		t.Fatal(err)
+	}
+	check("same redaction", map[string]int{shared: 1, "redacted": 2})
+
+	if _, err := db.Exec(`DELETE FROM events WHERE id = 'e1'`); err != nil {
+		t.Fatal(err)
+	}
+	check("delete event", map[string]int{shared: -1, "only e1": -1, "redacted": 2})
+
+	// Events removed along with their session release their bodies too.
+	if err := DeleteSession(db, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	check("delete session", map[string]int{"redacted": 1})
+	if err := DeleteProject(db, "p"); err != nil {
+		t.Fatal(err)
+	}
+	check("delete project", map[string]int{"redacted": -1})
+}
@@ -7,13 +7,59 @@ import (
 	"github.com/shigawire-dev/internal/models"
 )
 
+// eventColumns selects an event with its bodies; scanEvent reads a row of it.
+// Events stored before the bodies table existed keep their bodies inline
+// until Store.MoveInlineBodies has run.
+const eventColumns = `e.id, e.session_id, e.seq, e.started_at, e.ended_at, e.method, e.url, e.status,
+	        e.req_headers, e.resp_headers, e.req_body, e.resp_body, e.redaction_applied,
+	        e.req_body_encoding, e.resp_body_encoding, e.req_body_size, e.resp_body_size,
+	        e.req_body_sha256, e.resp_body_sha256, e.req_body_content_encoding, e.resp_body_content_encoding,
+	        e.req_body_truncated, e.resp_body_truncated, e.upstream_route,
+	        rb.data, COALESCE(rb.compression, ''), pb.data, COALESCE(pb.compression, '')
+	   FROM events e
+	   LEFT JOIN bodies rb ON rb.hash = e.req_body_ref AND e.req_body_ref != ''
+	   LEFT JOIN bodies pb ON pb.hash = e.resp_body_ref AND e.resp_body_ref != ''`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEvent(row rowScanner) (*models.Event, error) {
+	var e models.Event
+	var reqBody, respBody sql.NullString
+	var reqData, respData []byte
+	var reqCompression, respCompression string
+	if err := row.Scan(
+		&e.Id, &e.SessionId, &e.Seq, &e.StartedAt, &e.EndedAt, &e.Method, &e.URL, &e.Status,
+		&e.ReqHeaders, &e.RespHeaders, &reqBody, &respBody, &e.RedactionApplied,
+		&e.ReqBodyEncoding, &e.RespBodyEncoding, &e.ReqBodySize, &e.RespBodySize,
+		&e.ReqBodySHA256, &e.RespBodySHA256, &e.ReqBodyContentEncoding, &e.RespBodyContentEncoding,
+		&e.ReqBodyTruncated, &e.RespBodyTruncated, &e.UpstreamRoute,
+		&reqData, &reqCompression, &respData, &respCompression,
+	); err != nil {
+		return nil, err
+	}
+
+	e.ReqBody, e.RespBody = reqBody.String, respBody.String
+	var err error
+	if reqData != nil {
+		if e.ReqBody, err = decodeBody(reqData, reqCompression); err != nil {
+			return nil, err
+		}
+	}
+	if respData != nil {
+		if e.RespBody, err = decodeBody(respData, respCompression); err != nil {
+			return nil, err
+		}
+	}
+	return &e, nil
+}
+
 func ListEventsBySession(db *sql.DB, sessionId string) ([]*models.Event, error) {
 	rows, err := db.Query(
-		`SELECT id, session_id, seq, started_at, ended_at, method, url, status,
-		        req_headers, resp_headers, req_body, resp_body, redaction_applied
-		   FROM events
-		  WHERE session_id = ?
-		  ORDER BY seq ASC`,
+		`SELECT `+eventColumns+`
+		  WHERE e.session_id = ?
+		  ORDER BY e.seq ASC`,
 		sessionId,
 	)
 	if err != nil {
@@ -23,14 +69,11 @@ func ListEventsBySession(db *sql.DB, sessionId string) ([]*models.Event, error)
 
 	var out []*models.Event
 	for rows.Next() {
-		var e models.Event
-		if err := rows.Scan(
-			&e.Id, &e.SessionId, &e.Seq, &e.StartedAt, &e.EndedAt, &e.Method, &e.URL, &e.Status,
-			&e.ReqHeaders, &e.RespHeaders, &e.ReqBody, &e.RespBody, &e.RedactionApplied,
-		); err != nil {
+		e, err := scanEvent(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan event: %w", err)
 		}
-		out = append(out, &e)
+		out = append(out, e)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("rows events: %w", err)
@@ -54,17 +97,31 @@ func InsertEvent(db *sql.DB, e *models.Event) error {
 	}
 	e.Seq = nextSeq
 
+	reqRef, err := putBody(tx, e.ReqBody)
+	if err != nil {
+		return err
+	}
+	respRef, err := putBody(tx, e.RespBody)
+	if err != nil {
+		return err
+	}
+
 	_, err = tx.Exec(
 		`INSERT INTO events(
 			id, session_id, seq, started_at, ended_at, method, url, status,
-			req_headers, resp_headers, req_body, resp_body, redaction_applied
-		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			req_headers, resp_headers, req_body, resp_body, redaction_applied,
+			req_body_encoding, resp_body_encoding, req_body_size, resp_body_size,
+			req_body_sha256, resp_body_sha256, req_body_content_encoding, resp_body_content_encoding,
+			req_body_truncated, resp_body_truncated, req_body_ref, resp_body_ref, upstream_route
+		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '', '', ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		e.Id, e.SessionId, e.Seq,
 		e.StartedAt, e.EndedAt,
 		e.Method, e.URL, e.Status,
 		e.ReqHeaders, e.RespHeaders,
-		e.ReqBody, e.RespBody,
 		e.RedactionApplied,
+		e.ReqBodyEncoding, e.RespBodyEncoding, e.ReqBodySize, e.RespBodySize,
+		e.ReqBodySHA256, e.RespBodySHA256, e.ReqBodyContentEncoding, e.RespBodyContentEncoding,
+		e.ReqBodyTruncated, e.RespBodyTruncated, reqRef, respRef, e.UpstreamRoute,
 	)
 	if err != nil {
 		return fmt.Errorf("insert event: %w", err)
@@ -75,3 +132,59 @@ func InsertEvent(db *sql.DB, e *models.Event) error {
 	}
 	return nil
 }
+
+func GetEvent(db *sql.DB, id string) (*models.Event, error) {
+	e, err := scanEvent(db.QueryRow(
+		`SELECT `+eventColumns+`
+		  WHERE e.id = ?`,
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get event: %w", err)
+	}
+	return e, nil
+}
+
+func UpdateEventEndedAt(db *sql.DB, id string, endedAt string) error {
+	_, err := db.Exec(`UPDATE events SET ended_at = ? WHERE id = ?`, endedAt, id)
+	if err != nil {
+		return fmt.Errorf("update event ended_at: %w", err)
+	}
+	return nil
+}
+
+// UpdateEventRedaction stores the result of sanitizing an event again.
+func UpdateEventRedaction(db *sql.DB, e *models.Event) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin update event redaction tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	reqRef, err := putBody(tx, e.ReqBody)
+	if err != nil {
+		return err
+	}
+	respRef, err := putBody(tx, e.RespBody)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE events
+		    SET url = ?, req_headers = ?, resp_headers = ?, req_body = '', resp_body = '',
+		        req_body_ref = ?, resp_body_ref = ?, redaction_applied = ?
+		  WHERE id = ?`,
+		e.URL, e.ReqHeaders, e.RespHeaders, reqRef, respRef, e.RedactionApplied, e.Id,
+	); err != nil {
+		return fmt.Errorf("update event redaction: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit update event redaction: %w", err)
+	}
+	return nil
+}
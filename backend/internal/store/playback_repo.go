@@ -0,0 +1,48 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+func ListActivePlaybacks(db *sql.DB) ([]models.Playback, error) {
+	rows, err := db.Query(
+		`SELECT project_id, session_id, started_at
+		   FROM active_playbacks
+		  ORDER BY started_at ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.Playback
+	for rows.Next() {
+		var p models.Playback
+		if err := rows.Scan(&p.ProjectId, &p.SessionId, &p.StartedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func SetActivePlayback(db *sql.DB, p models.Playback) error {
+	if _, err := db.Exec(
+		`INSERT INTO active_playbacks (project_id, session_id, started_at)
+         VALUES (?, ?, ?)
+         ON CONFLICT(project_id) DO UPDATE SET session_id = excluded.session_id, started_at = excluded.started_at`,
+		p.ProjectId, p.SessionId, p.StartedAt,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func ClearActivePlayback(db *sql.DB, projectId string) error {
+	if _, err := db.Exec(`DELETE FROM active_playbacks WHERE project_id = ?`, projectId); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+// Parsed project configs, so proxied requests don't parse config_json and
+// compile its rules again. UpdateProject and DeleteProject drop a project's
+// entry; the cached configs are shared and must not be modified.
+var projectConfigs = struct {
+	sync.RWMutex
+	m map[projectConfigKey]*models.ProjectConfig
+	// gen counts the dropped entries, so a config loaded while its project
+	// was changed isn't cached.
+	gen uint64
+}{m: make(map[projectConfigKey]*models.ProjectConfig)}
+
+type projectConfigKey struct {
+	db        *sql.DB
+	projectId string
+}
+
+// GetProjectConfig returns the parsed config of a project.
+func GetProjectConfig(db *sql.DB, projectId string) (*models.ProjectConfig, error) {
+	key := projectConfigKey{db, projectId}
+	projectConfigs.RLock()
+	cfg, ok := projectConfigs.m[key]
+	gen := projectConfigs.gen
+	projectConfigs.RUnlock()
+	if ok {
+		return cfg, nil
+	}
+
+	p, err := GetProject(db, projectId)
+	if err != nil {
+		return nil, fmt.Errorf("load project: %w", err)
+	}
+	if p == nil {
+		return nil, fmt.Errorf("project not found: %s", projectId)
+	}
+	if cfg, err = models.ParseProjectConfig(p.ConfigJSON); err != nil {
+		return nil, fmt.Errorf("parse project config: %w", err)
+	}
+
+	projectConfigs.Lock()
+	if projectConfigs.gen == gen {
+		projectConfigs.m[key] = cfg
+	}
+	projectConfigs.Unlock()
+	return cfg, nil
+}
+
+// ForgetProjectConfig drops the cached config of a project, so the next
+// GetProjectConfig reads it from the database again.
+func ForgetProjectConfig(db *sql.DB, projectId string) {
+	projectConfigs.Lock()
+	delete(projectConfigs.m, projectConfigKey{db, projectId})
+	projectConfigs.gen++
+	projectConfigs.Unlock()
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+
+	"github.com/shigawire-dev/internal/redaction"
+)
+
+const redactionKeyBytes = 32
+
+// GetOrCreateRedactionKey returns the project's secret key for tokenized
+// redaction, generating it the first time it is needed. The key never leaves
+// the database through the API.
+func GetOrCreateRedactionKey(db *sql.DB, projectId string) ([]byte, error) {
+	key := make([]byte, redactionKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate redaction key: %w", err)
+	}
+
+	if _, err := db.Exec(
+		`INSERT INTO project_secrets(project_id, redaction_key) VALUES(?, ?)
+		 ON CONFLICT(project_id) DO NOTHING`,
+		projectId, key,
+	); err != nil {
+		return nil, fmt.Errorf("insert redaction key: %w", err)
+	}
+
+	var stored []byte
+	if err := db.QueryRow(
+		`SELECT redaction_key FROM project_secrets WHERE project_id = ?`,
+		projectId,
+	).Scan(&stored); err != nil {
+		return nil, fmt.Errorf("get redaction key: %w", err)
+	}
+	return stored, nil
+}
+
+// SetProjectClientKey stores the project's encrypted TLS client key; nil
+// removes it.
+func SetProjectClientKey(db *sql.DB, projectId string, ciphertext []byte) error {
+	// The secrets row is created along with the redaction key.
+	if _, err := GetOrCreateRedactionKey(db, projectId); err != nil {
+		return err
+	}
+	if _, err := db.Exec(
+		`UPDATE project_secrets SET client_key = ? WHERE project_id = ?`,
+		ciphertext, projectId,
+	); err != nil {
+		return fmt.Errorf("set client key: %w", err)
+	}
+	return nil
+}
+
+// GetProjectClientKey returns nil when the project has no TLS client key.
+func GetProjectClientKey(db *sql.DB, projectId string) ([]byte, error) {
+	var ct []byte
+	err := db.QueryRow(
+		`SELECT client_key FROM project_secrets WHERE project_id = ?`,
+		projectId,
+	).Scan(&ct)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get client key: %w", err)
+	}
+	return ct, nil
+}
+
+// ProjectRedactionPolicy resolves the redaction policy configured for a
+// project, including its token key when tokenization is enabled in the config
+// or forced by the caller (the secrets vault needs one placeholder per value).
+func ProjectRedactionPolicy(db *sql.DB, projectId string, forceTokenize bool) (redaction.Policy, error) {
+	cfg, err := GetProjectConfig(db, projectId)
+	if err != nil {
+		return redaction.Policy{}, err
+	}
+
+	policy := cfg.Redaction
+	if cfg.TokenizeRedactions || forceTokenize {
+		if policy.TokenKey, err = GetOrCreateRedactionKey(db, projectId); err != nil {
+			return redaction.Policy{}, err
+		}
+	}
+	return policy, nil
+}
@@ -61,6 +61,7 @@ func UpdateProject(db *sql.DB, p *models.Project) error {
 	if err != nil {
 		return fmt.Errorf("update project: %w", err)
 	}
+	ForgetProjectConfig(db, p.Id)
 	return nil
 }
 
@@ -69,5 +70,6 @@ func DeleteProject(db *sql.DB, id string) error {
 	if err != nil {
 		return fmt.Errorf("delete project: %w", err)
 	}
+	ForgetProjectConfig(db, id)
 	return nil
 }
@@ -1,32 +1,48 @@
 package store
 
-import "database/sql"
+import (
+	"database/sql"
 
-func GetActiveRecording(db *sql.DB) (projectId string, sessionId string, found bool, err error) {
-	row := db.QueryRow(`SELECT project_id, session_id FROM active_recording WHERE id = 1`)
-	if err := row.Scan(&projectId, &sessionId); err != nil {
-		if err == sql.ErrNoRows {
-			return "", "", false, nil
+	"github.com/shigawire-dev/internal/models"
+)
+
+func ListActiveRecordings(db *sql.DB) ([]models.Recording, error) {
+	rows, err := db.Query(
+		`SELECT project_id, session_id, route_kind, route_value, started_at
+		   FROM active_recordings
+		  ORDER BY started_at ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.Recording
+	for rows.Next() {
+		var r models.Recording
+		if err := rows.Scan(&r.ProjectId, &r.SessionId, &r.Route.Kind, &r.Route.Value, &r.StartedAt); err != nil {
+			return nil, err
 		}
-		return "", "", false, err
+		out = append(out, r)
 	}
-	return projectId, sessionId, true, nil
+	return out, rows.Err()
 }
 
-func SetActiveRecording(db *sql.DB, projectId, sessionId string) error {
+func SetActiveRecording(db *sql.DB, r models.Recording) error {
 	if _, err := db.Exec(
-		`INSERT INTO active_recording (id, project_id, session_id)
-         VALUES (1, ?, ?)
-         ON CONFLICT(id) DO UPDATE SET project_id = excluded.project_id, session_id = excluded.session_id`,
-		projectId, sessionId,
+		`INSERT INTO active_recordings (session_id, project_id, route_kind, route_value, started_at)
+         VALUES (?, ?, ?, ?, ?)
+         ON CONFLICT(session_id) DO UPDATE SET project_id = excluded.project_id,
+             route_kind = excluded.route_kind, route_value = excluded.route_value, started_at = excluded.started_at`,
+		r.SessionId, r.ProjectId, r.Route.Kind, r.Route.Value, r.StartedAt,
 	); err != nil {
 		return err
 	}
 	return nil
 }
 
-func ClearActiveRecording(db *sql.DB) error {
-	if _, err := db.Exec(`DELETE FROM active_recording WHERE id = 1`); err != nil {
+func ClearActiveRecording(db *sql.DB, sessionId string) error {
+	if _, err := db.Exec(`DELETE FROM active_recordings WHERE session_id = ?`, sessionId); err != nil {
 		return err
 	}
 	return nil
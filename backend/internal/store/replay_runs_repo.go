@@ -0,0 +1,153 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+func InsertReplayRun(db *sql.DB, r *models.ReplayRun) error {
+	_, err := db.Exec(
+		`INSERT INTO replay_runs(
+			id, project_id, session_id, target, speed, outcome, started_at, ended_at,
+			total_events, sent, failed, mismatched
+		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Id, r.ProjectId, r.SessionId, r.Target, r.Speed, r.Outcome, r.StartedAt, r.EndedAt,
+		r.TotalEvents, r.Sent, r.Failed, r.Mismatched,
+	)
+	if err != nil {
+		return fmt.Errorf("insert replay run: %w", err)
+	}
+	return nil
+}
+
+func FinishReplayRun(db *sql.DB, r *models.ReplayRun) error {
+	_, err := db.Exec(
+		`UPDATE replay_runs
+		    SET outcome = ?, ended_at = ?, sent = ?, failed = ?, mismatched = ?
+		  WHERE id = ?`,
+		r.Outcome, r.EndedAt, r.Sent, r.Failed, r.Mismatched, r.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("finish replay run: %w", err)
+	}
+	return nil
+}
+
+// MarkInterruptedReplayRuns closes out runs that were still going when the
+// process last exited.
+func MarkInterruptedReplayRuns(db *sql.DB, endedAt string) error {
+	_, err := db.Exec(
+		`UPDATE replay_runs SET outcome = ?, ended_at = ? WHERE outcome = ?`,
+		models.ReplayOutcomeInterrupted, endedAt, models.ReplayOutcomeRunning,
+	)
+	if err != nil {
+		return fmt.Errorf("mark interrupted replay runs: %w", err)
+	}
+	return nil
+}
+
+func ListReplayRunsBySession(db *sql.DB, sessionId string) ([]*models.ReplayRun, error) {
+	rows, err := db.Query(
+		`SELECT id, project_id, session_id, target, speed, outcome, started_at, ended_at,
+		        total_events, sent, failed, mismatched
+		   FROM replay_runs
+		  WHERE session_id = ?
+		  ORDER BY started_at DESC`,
+		sessionId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list replay runs: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*models.ReplayRun
+	for rows.Next() {
+		var r models.ReplayRun
+		if err := rows.Scan(
+			&r.Id, &r.ProjectId, &r.SessionId, &r.Target, &r.Speed, &r.Outcome, &r.StartedAt, &r.EndedAt,
+			&r.TotalEvents, &r.Sent, &r.Failed, &r.Mismatched,
+		); err != nil {
+			return nil, fmt.Errorf("scan replay run: %w", err)
+		}
+		out = append(out, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows replay runs: %w", err)
+	}
+	return out, nil
+}
+
+func GetReplayRun(db *sql.DB, id string) (*models.ReplayRun, error) {
+	var r models.ReplayRun
+	err := db.QueryRow(
+		`SELECT id, project_id, session_id, target, speed, outcome, started_at, ended_at,
+		        total_events, sent, failed, mismatched
+		   FROM replay_runs
+		  WHERE id = ?`,
+		id,
+	).Scan(
+		&r.Id, &r.ProjectId, &r.SessionId, &r.Target, &r.Speed, &r.Outcome, &r.StartedAt, &r.EndedAt,
+		&r.TotalEvents, &r.Sent, &r.Failed, &r.Mismatched,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get replay run: %w", err)
+	}
+	return &r, nil
+}
+
+func InsertReplayResult(db *sql.DB, r *models.ReplayResult) error {
+	_, err := db.Exec(
+		`INSERT INTO replay_results(
+			replay_id, seq, event_id, method, url, sent_at, duration_ms,
+			recorded_status, replayed_status, error, diff_json
+		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ReplayId, r.Seq, r.EventId, r.Method, r.URL, r.SentAt, r.DurationMs,
+		r.RecordedStatus, r.ReplayedStatus, r.Error, string(r.Diff),
+	)
+	if err != nil {
+		return fmt.Errorf("insert replay result: %w", err)
+	}
+	return nil
+}
+
+func ListReplayResults(db *sql.DB, replayId string) ([]*models.ReplayResult, error) {
+	rows, err := db.Query(
+		`SELECT replay_id, seq, event_id, method, url, sent_at, duration_ms,
+		        recorded_status, replayed_status, error, diff_json
+		   FROM replay_results
+		  WHERE replay_id = ?
+		  ORDER BY seq ASC`,
+		replayId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list replay results: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*models.ReplayResult
+	for rows.Next() {
+		var r models.ReplayResult
+		var diff string
+		if err := rows.Scan(
+			&r.ReplayId, &r.Seq, &r.EventId, &r.Method, &r.URL, &r.SentAt, &r.DurationMs,
+			&r.RecordedStatus, &r.ReplayedStatus, &r.Error, &diff,
+		); err != nil {
+			return nil, fmt.Errorf("scan replay result: %w", err)
+		}
+		if diff != "" {
+			r.Diff = json.RawMessage(diff)
+		}
+		out = append(out, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows replay results: %w", err)
+	}
+	return out, nil
+}
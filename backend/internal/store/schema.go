@@ -14,6 +14,12 @@ func InitSchema(db *sql.DB) error {
 			created_at TEXT NOT NULL
 		);`,
 
+		`CREATE TABLE IF NOT EXISTS project_secrets(
+			project_id TEXT PRIMARY KEY,
+			redaction_key BLOB NOT NULL,
+			FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+		);`,
+
 		`CREATE TABLE IF NOT EXISTS sessions(
 			id TEXT PRIMARY KEY,
 			project_id TEXT NOT NULL,
@@ -24,10 +30,20 @@ func InitSchema(db *sql.DB) error {
 			FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
 		);`,
 
-		`CREATE TABLE IF NOT EXISTS active_recording(
-			id INTEGER PRIMARY KEY CHECK (id = 1),
+		`CREATE TABLE IF NOT EXISTS active_recordings(
+			session_id TEXT PRIMARY KEY,
 			project_id TEXT NOT NULL,
+			route_kind TEXT NOT NULL DEFAULT '',
+			route_value TEXT NOT NULL DEFAULT '',
+			started_at TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS active_playbacks(
+			project_id TEXT PRIMARY KEY,
 			session_id TEXT NOT NULL,
+			started_at TEXT NOT NULL DEFAULT '',
 			FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE,
 			FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
 		);`,
@@ -46,15 +62,102 @@ func InitSchema(db *sql.DB) error {
 			req_body TEXT,
 			resp_body TEXT,
 			redaction_applied TEXT,
+			req_body_encoding TEXT NOT NULL DEFAULT '',
+			resp_body_encoding TEXT NOT NULL DEFAULT '',
+			req_body_size INTEGER NOT NULL DEFAULT 0,
+			resp_body_size INTEGER NOT NULL DEFAULT 0,
+			req_body_sha256 TEXT NOT NULL DEFAULT '',
+			resp_body_sha256 TEXT NOT NULL DEFAULT '',
+			req_body_content_encoding TEXT NOT NULL DEFAULT '',
+			resp_body_content_encoding TEXT NOT NULL DEFAULT '',
+			req_body_truncated INTEGER NOT NULL DEFAULT 0,
+			resp_body_truncated INTEGER NOT NULL DEFAULT 0,
+			req_body_ref TEXT NOT NULL DEFAULT '',
+			resp_body_ref TEXT NOT NULL DEFAULT '',
+			upstream_route TEXT NOT NULL DEFAULT '',
 			FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE,
 			UNIQUE(session_id, seq)
 		);`,
 
+		// Event bodies, keyed by the SHA-256 of their stored content so that
+		// repeated bodies are kept once. ref_count is maintained by the
+		// triggers below.
+		`CREATE TABLE IF NOT EXISTS bodies(
+			hash TEXT PRIMARY KEY,
+			compression TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			ref_count INTEGER NOT NULL DEFAULT 0
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS ws_frames(
+			id TEXT PRIMARY KEY,
+			event_id TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			direction TEXT NOT NULL,
+			opcode INTEGER NOT NULL,
+			timestamp TEXT NOT NULL,
+			payload TEXT NOT NULL DEFAULT '',
+			payload_encoding TEXT NOT NULL DEFAULT '',
+			size INTEGER NOT NULL DEFAULT 0,
+			redaction_applied TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY(event_id) REFERENCES events(id) ON DELETE CASCADE,
+			UNIQUE(event_id, seq)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS vault_entries(
+			event_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			placeholder TEXT NOT NULL,
+			ciphertext BLOB NOT NULL,
+			PRIMARY KEY(event_id, placeholder),
+			FOREIGN KEY(event_id) REFERENCES events(id) ON DELETE CASCADE
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS replay_runs(
+			id TEXT PRIMARY KEY,
+			project_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			target TEXT NOT NULL,
+			speed REAL NOT NULL,
+			outcome TEXT NOT NULL,
+			started_at TEXT NOT NULL,
+			ended_at TEXT NOT NULL DEFAULT '',
+			total_events INTEGER NOT NULL DEFAULT 0,
+			sent INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			mismatched INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY(session_id) REFERENCES sessions(id) ON DELETE CASCADE
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS replay_results(
+			replay_id TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			event_id TEXT NOT NULL,
+			method TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			sent_at TEXT NOT NULL,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			recorded_status INTEGER NOT NULL DEFAULT 0,
+			replayed_status INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			diff_json TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY(replay_id) REFERENCES replay_runs(id) ON DELETE CASCADE,
+			UNIQUE(replay_id, seq)
+		);`,
+
 		`CREATE INDEX IF NOT EXISTS idx_sessions_project_created
 			ON sessions(project_id, created_at);`,
 
 		`CREATE INDEX IF NOT EXISTS idx_events_session_seq
 			ON events(session_id, seq);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_replay_runs_session_started
+			ON replay_runs(session_id, started_at);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_vault_entries_session_placeholder
+			ON vault_entries(session_id, placeholder);`,
 	}
 
 	for _, q := range ddl {
@@ -65,11 +168,65 @@ func InitSchema(db *sql.DB) error {
 
 	migrations := []string{
 		`ALTER TABLE sessions ADD COLUMN updated_at TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN req_body_encoding TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN resp_body_encoding TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN req_body_size INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE events ADD COLUMN resp_body_size INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE events ADD COLUMN req_body_sha256 TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN resp_body_sha256 TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN req_body_content_encoding TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN resp_body_content_encoding TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN req_body_truncated INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE events ADD COLUMN resp_body_truncated INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE events ADD COLUMN req_body_ref TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN resp_body_ref TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN upstream_route TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE project_secrets ADD COLUMN client_key BLOB`,
+		// Single recording of earlier versions, which record every request.
+		`INSERT OR IGNORE INTO active_recordings (session_id, project_id)
+			SELECT session_id, project_id FROM active_recording`,
+		`DROP TABLE IF EXISTS active_recording`,
+		// Single playback of earlier versions, which answered every project.
+		`INSERT OR IGNORE INTO active_playbacks (project_id, session_id)
+			SELECT project_id, session_id FROM active_playback`,
+		`DROP TABLE IF EXISTS active_playback`,
 	}
 	for _, m := range migrations {
 		_, _ = db.Exec(m)
 	}
 
+	// Body reference counting. Triggers also fire for events removed by a
+	// cascading session or project delete, so bodies no event refers to any
+	// more are dropped however the events went away.
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS events_body_refs_insert AFTER INSERT ON events
+		BEGIN
+			UPDATE bodies SET ref_count = ref_count + 1 WHERE hash = NEW.req_body_ref;
+			UPDATE bodies SET ref_count = ref_count + 1 WHERE hash = NEW.resp_body_ref;
+		END;`,
+
+		`CREATE TRIGGER IF NOT EXISTS events_body_refs_update AFTER UPDATE OF req_body_ref, resp_body_ref ON events
+		BEGIN
+			UPDATE bodies SET ref_count = ref_count + 1 WHERE hash = NEW.req_body_ref;
+			UPDATE bodies SET ref_count = ref_count + 1 WHERE hash = NEW.resp_body_ref;
+			UPDATE bodies SET ref_count = ref_count - 1 WHERE hash = OLD.req_body_ref;
+			UPDATE bodies SET ref_count = ref_count - 1 WHERE hash = OLD.resp_body_ref;
+			DELETE FROM bodies WHERE hash IN (OLD.req_body_ref, OLD.resp_body_ref) AND ref_count <= 0;
+		END;`,
+
+		`CREATE TRIGGER IF NOT EXISTS events_body_refs_delete AFTER DELETE ON events
+		BEGIN
+			UPDATE bodies SET ref_count = ref_count - 1 WHERE hash = OLD.req_body_ref;
+			UPDATE bodies SET ref_count = ref_count - 1 WHERE hash = OLD.resp_body_ref;
+			DELETE FROM bodies WHERE hash IN (OLD.req_body_ref, OLD.resp_body_ref) AND ref_count <= 0;
+		END;`,
+	}
+	for _, q := range triggers {
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("schema exec failed: %w", err)
+		}
+	}
+
 	if _, err := db.Exec(
 		`UPDATE sessions SET updated_at = created_at WHERE updated_at = ''`,
 	); err != nil {
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+func InsertVaultEntry(db *sql.DB, v *models.VaultEntry) error {
+	_, err := db.Exec(
+		`INSERT INTO vault_entries(event_id, session_id, placeholder, ciphertext)
+		 VALUES(?, ?, ?, ?)
+		 ON CONFLICT(event_id, placeholder) DO NOTHING`,
+		v.EventId, v.SessionId, v.Placeholder, v.Ciphertext,
+	)
+	if err != nil {
+		return fmt.Errorf("insert vault entry: %w", err)
+	}
+	return nil
+}
+
+// GetVaultCiphertext returns nil when the session has no entry for placeholder.
+func GetVaultCiphertext(db *sql.DB, sessionId, placeholder string) ([]byte, error) {
+	var ct []byte
+	err := db.QueryRow(
+		`SELECT ciphertext FROM vault_entries
+		  WHERE session_id = ? AND placeholder = ?
+		  LIMIT 1`,
+		sessionId, placeholder,
+	).Scan(&ct)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get vault entry: %w", err)
+	}
+	return ct, nil
+}
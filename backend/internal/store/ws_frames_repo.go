@@ -0,0 +1,66 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+func InsertWSFrame(db *sql.DB, f *models.WSFrame) error {
+	_, err := db.Exec(
+		`INSERT INTO ws_frames(
+			id, event_id, seq, direction, opcode, timestamp,
+			payload, payload_encoding, size, redaction_applied
+		) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.Id, f.EventId, f.Seq, f.Direction, f.Opcode, f.Timestamp,
+		f.Payload, f.PayloadEncoding, f.Size, f.RedactionApplied,
+	)
+	if err != nil {
+		return fmt.Errorf("insert ws frame: %w", err)
+	}
+	return nil
+}
+
+func ListWSFramesByEvent(db *sql.DB, eventId string) ([]*models.WSFrame, error) {
+	rows, err := db.Query(
+		`SELECT id, event_id, seq, direction, opcode, timestamp,
+		        payload, payload_encoding, size, redaction_applied
+		   FROM ws_frames
+		  WHERE event_id = ?
+		  ORDER BY seq ASC`,
+		eventId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list ws frames: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*models.WSFrame
+	for rows.Next() {
+		var f models.WSFrame
+		if err := rows.Scan(
+			&f.Id, &f.EventId, &f.Seq, &f.Direction, &f.Opcode, &f.Timestamp,
+			&f.Payload, &f.PayloadEncoding, &f.Size, &f.RedactionApplied,
+		); err != nil {
+			return nil, fmt.Errorf("scan ws frame: %w", err)
+		}
+		out = append(out, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows ws frames: %w", err)
+	}
+	return out, nil
+}
+
+// UpdateWSFrameRedaction stores the result of sanitizing a frame again.
+func UpdateWSFrameRedaction(db *sql.DB, f *models.WSFrame) error {
+	_, err := db.Exec(
+		`UPDATE ws_frames SET payload = ?, redaction_applied = ? WHERE id = ?`,
+		f.Payload, f.RedactionApplied, f.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("update ws frame redaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+// Pool keeps a long-lived client for each project, so connections to its
+// upstreams are reused across requests. A client is replaced when the
+// project's TLS or transport settings change.
+type Pool struct {
+	mu        sync.Mutex
+	clients   map[string]*pooledClient
+	clientKey ClientKeyFunc
+}
+
+// ClientKeyFunc returns a project's TLS client key, which is stored apart
+// from its config.
+type ClientKeyFunc func(projectId string) (string, error)
+
+type pooledClient struct {
+	settings string
+	client   *http.Client
+}
+
+func NewPool(clientKey ClientKeyFunc) *Pool {
+	return &Pool{clients: make(map[string]*pooledClient), clientKey: clientKey}
+}
+
+// Client returns the client for projectId, whose config is cfg.
+func (p *Pool) Client(projectId string, cfg *models.ProjectConfig) (*http.Client, error) {
+	settings := cfg.UpstreamSettings()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[projectId]; ok && c.settings == settings {
+		return c.client, nil
+	}
+
+	t, err := p.newTransport(projectId, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if old, ok := p.clients[projectId]; ok {
+		old.client.CloseIdleConnections()
+	}
+	c := &http.Client{Transport: t, Timeout: Timeout(cfg)}
+	p.clients[projectId] = &pooledClient{settings: settings, client: c}
+	return c, nil
+}
+
+// newTransport builds the project's transport with its stored client key.
+func (p *Pool) newTransport(projectId string, cfg *models.ProjectConfig) (*http.Transport, error) {
+	if cfg.TLS == nil || !cfg.TLS.HasClientKey || cfg.TLS.ClientKeyPem != "" {
+		return NewTransport(cfg)
+	}
+	if p.clientKey == nil {
+		return nil, fmt.Errorf("load tls client key: no key store")
+	}
+	key, err := p.clientKey(projectId)
+	if err != nil {
+		return nil, fmt.Errorf("load tls client key: %w", err)
+	}
+	// cfg is shared; the key goes into copies.
+	tc := *cfg.TLS
+	tc.ClientKeyPem = key
+	withKey := *cfg
+	withKey.TLS = &tc
+	return NewTransport(&withKey)
+}
+
+// Forget closes the idle connections of a deleted project's client.
+func (p *Pool) Forget(projectId string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[projectId]; ok {
+		c.client.CloseIdleConnections()
+		delete(p.clients, projectId)
+	}
+}
@@ -0,0 +1,122 @@
+package upstream
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+// parseConfig returns the config stored for configJSON, and its client key.
+func parseConfig(t *testing.T, configJSON string) (*models.ProjectConfig, string) {
+	t.Helper()
+	normalized, key, err := models.NormalizeProjectConfig(configJSON, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := models.ParseProjectConfig(normalized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, key
+}
+
+func TestPoolReusesClients(t *testing.T) {
+	p := NewPool(nil)
+	base, _ := parseConfig(t, `{"targetHost":"app","targetPort":80}`)
+	moved, _ := parseConfig(t, `{"targetHost":"other","targetPort":8080}`)
+	tuned, _ := parseConfig(t, `{"targetHost":"app","targetPort":80,"transport":{"timeoutMs":1000}}`)
+
+	c1, err := p.Client("p", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The upstream address isn't part of the settings.
+	if c, _ := p.Client("p", moved); c != c1 {
+		t.Error("a new upstream address replaced the client")
+	}
+	if c, _ := p.Client("q", base); c == c1 {
+		t.Error("two projects share a client")
+	}
+
+	c2, err := p.Client("p", tuned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 == c1 || c2.Timeout != time.Second {
+		t.Errorf("changed transport settings kept the client, timeout %v", c2.Timeout)
+	}
+	if c, _ := p.Client("p", tuned); c != c2 {
+		t.Error("unchanged settings replaced the client")
+	}
+
+	p.Forget("p")
+	if c, _ := p.Client("p", tuned); c == c2 {
+		t.Error("a forgotten project kept its client")
+	}
+}
+
+func TestPoolLoadsClientKey(t *testing.T) {
+	certPem, keyPem := clientCertificate(t)
+	tc, _ := json.Marshal(map[string]string{"clientCertPem": certPem, "clientKeyPem": keyPem})
+	cfg, key := parseConfig(t, `{"targetScheme":"https","targetHost":"app","targetPort":443,"tls":`+string(tc)+`}`)
+	if key != strings.TrimSpace(keyPem) || cfg.TLS.ClientKeyPem != "" || !cfg.TLS.HasClientKey {
+		t.Fatalf("stored tls section = %+v", cfg.TLS)
+	}
+
+	if _, err := NewPool(nil).Client("p", cfg); err == nil {
+		t.Error("a pool without a key store built a client")
+	}
+
+	var loaded []string
+	p := NewPool(func(projectId string) (string, error) {
+		loaded = append(loaded, projectId)
+		return key, nil
+	})
+	c, err := p.Client("p", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Transport.(*http.Transport).TLSClientConfig.Certificates; len(got) != 1 {
+		t.Errorf("transport has %d client certificates", len(got))
+	}
+	if len(loaded) != 1 || loaded[0] != "p" || cfg.TLS.ClientKeyPem != "" {
+		t.Errorf("loaded keys for %v; shared config now has key %q", loaded, cfg.TLS.ClientKeyPem)
+	}
+}
+
+func clientCertificate(t *testing.T) (certPem, keyPem string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPem = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+	return certPem, keyPem
+}
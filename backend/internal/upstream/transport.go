@@ -0,0 +1,109 @@
+// Package upstream builds the transports the proxy and replays use to reach
+// project upstreams.
+package upstream
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/shigawire-dev/internal/models"
+)
+
+// Defaults for the settings of models.TransportConfig.
+const (
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+	DefaultMaxIdleConns        = 100
+
+	// DefaultResponseHeaderTimeout is no limit: slow upstreams are proxied
+	// as they are unless a project sets one.
+	DefaultResponseHeaderTimeout time.Duration = 0
+)
+
+// Default reaches upstreams of requests that don't belong to a project's
+// upstream, such as forward-proxied ones, with the default settings. Without
+// a config NewTransport can't fail.
+var Default, _ = NewTransport(nil)
+
+// NewTransport returns a transport with a project's TLS, timeout and pooling
+// settings. It has no overall deadline; see Timeout.
+func NewTransport(cfg *models.ProjectConfig) (*http.Transport, error) {
+	var tc *models.TransportConfig
+	var tlsConfig *tls.Config
+	if cfg != nil {
+		tc = cfg.Transport
+		if cfg.TLS != nil {
+			var err error
+			if tlsConfig, err = cfg.TLS.ClientConfig(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tc == nil {
+		tc = &models.TransportConfig{}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   orDefault(tc.DialTimeoutMs, DefaultDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	maxIdle := DefaultMaxIdleConns
+	if tc.MaxIdleConns > 0 {
+		maxIdle = tc.MaxIdleConns
+	}
+
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   orDefault(tc.TLSHandshakeTimeoutMs, DefaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: orDefault(tc.ResponseHeaderTimeoutMs, DefaultResponseHeaderTimeout),
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		// Most projects talk to a single host, so it may use the whole pool.
+		MaxIdleConns:        maxIdle,
+		MaxIdleConnsPerHost: maxIdle,
+		ForceAttemptHTTP2:   true,
+	}
+	if tc.HTTP2 != nil && !*tc.HTTP2 {
+		// A non-nil, empty map keeps the transport from negotiating h2.
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t, nil
+}
+
+// Timeout returns the deadline of a whole exchange with the project's
+// upstreams, or 0 for none.
+func Timeout(cfg *models.ProjectConfig) time.Duration {
+	if cfg == nil || cfg.Transport == nil {
+		return 0
+	}
+	return millis(cfg.Transport.TimeoutMs)
+}
+
+func orDefault(ms int, def time.Duration) time.Duration {
+	if ms > 0 {
+		return millis(ms)
+	}
+	return def
+}
+
+func millis(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+// WebSocketTLSConfig returns a copy of t's TLS settings for dialing WebSocket
+// upgrades, which need HTTP/1.1. net/http fills in t.TLSClientConfig lazily,
+// adding h2 to its protocols; Clone waits for that, so the copy is safe to
+// read and change.
+func WebSocketTLSConfig(t *http.Transport) *tls.Config {
+	cfg := t.Clone().TLSClientConfig
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg.NextProtos = []string{"http/1.1"}
+	return cfg
+}
@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/shigawire-dev/internal/models"
+	"github.com/shigawire-dev/internal/store"
+)
+
+const keyBytes = 32
+
+// Vault keeps the original values behind redaction placeholders, encrypted
+// with AES-256-GCM under a key that only exists in the environment. Originals
+// are decrypted in memory, on demand, by replay and playback; they are never
+// returned by the API.
+type Vault struct {
+	aead cipher.AEAD
+}
+
+// FromEnv builds the vault from VAULT_KEY (32 bytes, base64 or hex encoded).
+// It returns nil without error when VAULT_KEY is unset, leaving the vault off.
+func FromEnv() (*Vault, error) {
+	raw := strings.TrimSpace(os.Getenv("VAULT_KEY"))
+	if raw == "" {
+		return nil, nil
+	}
+
+	key, err := decodeKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("VAULT_KEY: %w", err)
+	}
+	return New(key)
+}
+
+func New(key []byte) (*Vault, error) {
+	if len(key) != keyBytes {
+		return nil, fmt.Errorf("vault key must be %d bytes, got %d", keyBytes, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("init vault cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("init vault cipher: %w", err)
+	}
+	return &Vault{aead: aead}, nil
+}
+
+func decodeKey(raw string) ([]byte, error) {
+	if key, err := base64.StdEncoding.DecodeString(raw); err == nil && len(key) == keyBytes {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(raw); err == nil && len(key) == keyBytes {
+		return key, nil
+	}
+	return nil, errors.New("expected 32 bytes encoded as base64 or hex")
+}
+
+// seal encrypts value. The placeholder is bound as additional data so a
+// ciphertext can't be moved to a different placeholder.
+func (v *Vault) seal(placeholder, value string) ([]byte, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return v.aead.Seal(nonce, nonce, []byte(value), []byte(placeholder)), nil
+}
+
+func (v *Vault) open(placeholder string, ciphertext []byte) (string, error) {
+	n := v.aead.NonceSize()
+	if len(ciphertext) < n {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := v.aead.Open(nil, ciphertext[:n], ciphertext[n:], []byte(placeholder))
+	if err != nil {
+		return "", fmt.Errorf("decrypt vault entry: %w", err)
+	}
+	return string(plain), nil
+}
+
+// Store encrypts the originals redacted from one event, keyed by placeholder.
+func (v *Vault) Store(db *sql.DB, sessionId, eventId string, originals map[string]string) error {
+	for placeholder, value := range originals {
+		ct, err := v.seal(placeholder, value)
+		if err != nil {
+			return err
+		}
+		if err := store.InsertVaultEntry(db, &models.VaultEntry{
+			EventId:     eventId,
+			SessionId:   sessionId,
+			Placeholder: placeholder,
+			Ciphertext:  ct,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup returns the original value for a placeholder recorded in sessionId.
+// Tokenized placeholders identify one value, so any event's entry will do.
+func (v *Vault) Lookup(db *sql.DB, sessionId, placeholder string) (string, bool, error) {
+	ct, err := store.GetVaultCiphertext(db, sessionId, placeholder)
+	if err != nil || ct == nil {
+		return "", false, err
+	}
+	value, err := v.open(placeholder, ct)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// clientKeyLabel is the additional data of a project's TLS client key, so
+// the ciphertext can't be moved to another project or a placeholder.
+func clientKeyLabel(projectId string) string {
+	return "client_key:" + projectId
+}
+
+// StoreClientKey encrypts a project's TLS client key into its secrets. An
+// empty key removes the stored one.
+func (v *Vault) StoreClientKey(db *sql.DB, projectId, keyPem string) error {
+	if keyPem == "" {
+		return store.SetProjectClientKey(db, projectId, nil)
+	}
+	ct, err := v.seal(clientKeyLabel(projectId), keyPem)
+	if err != nil {
+		return err
+	}
+	return store.SetProjectClientKey(db, projectId, ct)
+}
+
+// ClientKey returns a project's TLS client key, or "" when it has none.
+func (v *Vault) ClientKey(db *sql.DB, projectId string) (string, error) {
+	ct, err := store.GetProjectClientKey(db, projectId)
+	if err != nil || ct == nil {
+		return "", err
+	}
+	if v == nil {
+		return "", errors.New("the project's tls client key needs VAULT_KEY to be set")
+	}
+	return v.open(clientKeyLabel(projectId), ct)
+}
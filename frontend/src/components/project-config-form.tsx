@@ -277,6 +277,27 @@ export function ProjectConfigForm({
                   />
                 </div>
               </div>
+
+              <div className="space-y-2">
+                <label className="text-xs font-mono text-blue-400 uppercase tracking-wider">
+                  Proxy Listen Port
+                </label>
+                <input
+                  type="number"
+                  placeholder="Shared proxy port"
+                  value={config.listenPort || ""}
+                  onChange={(e) =>
+                    setConfig({
+                      ...config,
+                      listenPort: parseInt(e.target.value) || undefined,
+                    })
+                  }
+                  className="w-full bg-blue-900/10 border border-blue-900/50 rounded px-4 py-2 text-blue-200 font-mono focus:outline-none focus:border-blue-600/50"
+                />
+                <p className="text-xs font-mono text-blue-400/70">
+                  Optional. Requests sent to this port always reach the upstream above.
+                </p>
+              </div>
             </div>
           </form>
         </div>
@@ -11,6 +11,7 @@ import {
   Session,
   deleteSession,
   getGlobalRecordingStatus,
+  isSessionRecording,
   startRecording,
   stopRecording,
   stopCapture,
@@ -104,9 +105,7 @@ export function ReplayView({ projectId, sessionId, onBack, onDeleteSession }: Re
   const liveCapture =
     Boolean(projectId) &&
     Boolean(sessionId) &&
-    recordingStatus?.recording === true &&
-    recordingStatus.session_id === sessionId &&
-    recordingStatus.project_id === projectId
+    isSessionRecording(recordingStatus, sessionId)
 
   useEffect(() => {
     if (!liveCapture || !projectId || !sessionId) return
@@ -136,6 +135,7 @@ export function ReplayView({ projectId, sessionId, onBack, onDeleteSession }: Re
     ws.onmessage = (e) => {
       try {
         const msg = JSON.parse(e.data)
+        if (msg.type === 'diff') return
         const n = Number(msg.current_seq)
         setCurrentReplaySeq(Number.isFinite(n) ? n : null)
         setReplayStatus(msg.status)
@@ -160,22 +160,24 @@ export function ReplayView({ projectId, sessionId, onBack, onDeleteSession }: Re
   }, [replayId])
 
   const isSealed = session?.sealed === true
-  const isRecordingThisSession =
-    recordingStatus?.recording &&
-    recordingStatus.session_id === sessionId &&
-    recordingStatus.project_id === projectId
+  const isRecordingThisSession = isSessionRecording(recordingStatus, sessionId)
 
   const replayActive = replayStatus !== 'idle'
 
   const handleStartRecording = async () => {
     if (!projectId || !sessionId || isSealed) return;
 
-    // Check global recording status
+    // Check global recording status. Recordings started here take every
+    // request no other route matches, so only another session on that
+    // default route is in the way.
     const status = await getGlobalRecordingStatus();
     if (status && status.recording) {
-      if (status.session_id === sessionId) {
+      const defaultRouteTaken = status.recordings
+        ? status.recordings.some((r) => r.route.kind === '')
+        : true
+      if (isSessionRecording(status, sessionId)) {
         return;
-      } else {
+      } else if (defaultRouteTaken) {
         showError({
           severity: 'warning',
           title: 'Recording already active',
@@ -314,7 +316,7 @@ export function ReplayView({ projectId, sessionId, onBack, onDeleteSession }: Re
                 Sealed
               </span>
             )}
-            {recordingStatus?.recording && recordingStatus.session_id === sessionId && (
+            {isRecordingThisSession && (
               <span className="flex items-center gap-2 px-2 py-0.5 ml-2 rounded border border-orange-500/50 bg-orange-500/20 text-orange-400 text-xs font-mono">
                 <div className="w-2 h-2 rounded-full bg-orange-500 animate-pulse" />
                 Recording
@@ -65,6 +65,11 @@ export function RequestInspector({ requestIndex, events = [] }: { requestIndex:
                 <span className="text-blue-300 font-bold">{event.method}</span>{' '}
                 <span className="text-blue-400/70">{event.url}</span>
               </div>
+              {event.upstream_route && (
+                <div className="text-blue-400/70 text-xs">
+                  Route: <span className="text-blue-300">{event.upstream_route}</span>
+                </div>
+              )}
               {event.started_at && (
                 <div className="text-blue-400/70 text-xs mt-2">
                   {new Date(event.started_at).toLocaleString()}
@@ -7,6 +7,7 @@ import {
   getSessionEvents,
   listSessions,
   listAllSessions,
+  isSessionRecording,
   Session,
 } from '@/lib/api'
 import { useRecordingStatusStream } from '@/hooks/use-recording-status-stream'
@@ -110,7 +111,7 @@ export function SessionList({ projectId, onSessionSelect }: SessionListProps) {
         ) : (
           <div className="divide-y divide-blue-900/50">
             {sessions.map((session) => {
-              const isRecording = recordingStatus?.recording && recordingStatus.session_id === session.id
+              const isRecording = isSessionRecording(recordingStatus, session.id)
               return (
                 <SessionRow
                   key={session.id}
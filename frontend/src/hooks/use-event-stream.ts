@@ -5,6 +5,7 @@ import { getEventStreamUrl } from "@/lib/backend";
 import { subscribeReconnectingEventSource } from "@/lib/event-source-reconnect";
 
 export interface EventNotification {
+  type?: string;
   session_id: string;
   event_id: string;
   method: string;
@@ -44,6 +45,7 @@ export function useEventStream(sessionId: string | null): {
         try {
           const n = JSON.parse(ev.data) as EventNotification;
           n.arrived_at = Date.now();
+          if (n.type) return;
           if (n.session_id !== sessionIdRef.current) return;
           setEvents((prev) => [...prev, n]);
         } catch {
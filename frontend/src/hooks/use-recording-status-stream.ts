@@ -1,7 +1,7 @@
 "use client";
 
 import { useCallback, useEffect, useRef, useState } from "react";
-import { getGlobalRecordingStatus, type RecordingStatus } from "@/lib/api";
+import { getGlobalRecordingStatus, type ActiveRecording, type RecordingStatus } from "@/lib/api";
 import { getRecordingStreamUrl } from "@/lib/backend";
 import { subscribeReconnectingEventSource } from "@/lib/event-source-reconnect";
 
@@ -12,6 +12,7 @@ function parseRecordingStatus(data: unknown): RecordingStatus | null {
     recording: Boolean(o.recording),
     project_id: typeof o.project_id === "string" ? o.project_id : "",
     session_id: typeof o.session_id === "string" ? o.session_id : "",
+    recordings: Array.isArray(o.recordings) ? (o.recordings as ActiveRecording[]) : [],
   };
 }
 
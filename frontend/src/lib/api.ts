@@ -5,6 +5,37 @@ export interface ProjectConfig {
   targetHost?: string;
   targetPort?: number;
   targetScheme?: 'http' | 'https';
+  // Optional proxy port of the project's own; clients pointed at it always
+  // reach this project's upstream.
+  listenPort?: number;
+  tls?: UpstreamTLSConfig;
+  transport?: TransportConfig;
+  redaction?: RedactionConfig;
+}
+
+export interface UpstreamTLSConfig {
+  caPem?: string;
+  clientCertPem?: string;
+  clientKeyPem?: string; // write-only; never returned
+  hasClientKey?: boolean; // sent back without clientKeyPem, keeps the stored key
+  serverName?: string;
+  insecureSkipVerify?: boolean;
+}
+
+export interface TransportConfig {
+  dialTimeoutMs?: number;
+  tlsHandshakeTimeoutMs?: number;
+  responseHeaderTimeoutMs?: number; // no limit by default
+  timeoutMs?: number; // whole exchange; none by default
+  maxIdleConns?: number;
+  http2?: boolean;
+}
+
+export interface RedactionConfig {
+  headerDenylist?: string[];
+  jsonKeyDenylist?: string[];
+  includeDefaults?: boolean;
+  defaultValueRules?: boolean; // jwt, bearer_token, credit_card and aws_key detectors; off by default
 }
 
 export interface Project {
@@ -44,13 +75,40 @@ export interface Event {
   resp_body_b64?: string;
   req_body_truncated?: boolean;
   resp_body_truncated?: boolean;
+  req_body_size?: number;
+  resp_body_size?: number;
+  req_body_sha256?: string;
+  resp_body_sha256?: string;
+  req_body_content_encoding?: string;
+  resp_body_content_encoding?: string;
   redaction_applied?: string;
+  upstream_route?: string; // routing table entry the request went through
+}
+
+export interface RecordingRoute {
+  kind: "" | "header" | "host" | "path_prefix";
+  value?: string;
+}
+
+export interface ActiveRecording {
+  project_id: string;
+  session_id: string;
+  route: RecordingRoute;
+  started_at: string;
 }
 
 export interface RecordingStatus {
   recording: boolean;
+  // The oldest active recording.
   project_id: string;
   session_id: string;
+  recordings?: ActiveRecording[];
+}
+
+export function isSessionRecording(status: RecordingStatus | null, sessionId: string | null): boolean {
+  if (!status?.recording || !sessionId) return false;
+  if (status.recordings) return status.recordings.some((r) => r.session_id === sessionId);
+  return status.session_id === sessionId;
 }
 
 const UI_REDACTED_VALUE = "[REDACTED]";